@@ -4,8 +4,11 @@
 package api4
 
 import (
+	"archive/zip"
 	"bytes"
 	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
@@ -17,6 +20,7 @@ import (
 
 	"github.com/mattermost/mattermost-server/app"
 	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/services/imagetransform"
 	"github.com/mattermost/mattermost-server/utils"
 )
 
@@ -53,9 +57,17 @@ func (api *API) InitFile() {
 	api.BaseRoutes.File.Handle("", api.ApiSessionRequiredTrustRequester(getFile)).Methods("GET")
 	api.BaseRoutes.File.Handle("/thumbnail", api.ApiSessionRequiredTrustRequester(getFileThumbnail)).Methods("GET")
 	api.BaseRoutes.File.Handle("/link", api.ApiSessionRequired(getFileLink)).Methods("GET")
+	api.BaseRoutes.File.Handle("/link", api.ApiSessionRequired(revokeFileLink)).Methods("DELETE")
 	api.BaseRoutes.File.Handle("/preview", api.ApiSessionRequiredTrustRequester(getFilePreview)).Methods("GET")
 	api.BaseRoutes.File.Handle("/info", api.ApiSessionRequired(getFileInfo)).Methods("GET")
 
+	api.BaseRoutes.Files.Handle("/archive", api.ApiSessionRequired(getFilesArchive)).Methods("GET")
+
+	api.BaseRoutes.Files.Handle("/resumable", api.ApiSessionRequired(createUploadSession)).Methods("POST")
+	api.BaseRoutes.Files.Handle("/resumable/{upload_id:[A-Za-z0-9]+}", api.ApiSessionRequired(getUploadSessionOffset)).Methods("HEAD")
+	api.BaseRoutes.Files.Handle("/resumable/{upload_id:[A-Za-z0-9]+}", api.ApiSessionRequired(uploadSessionData)).Methods("PATCH")
+	api.BaseRoutes.Files.Handle("/resumable/{upload_id:[A-Za-z0-9]+}", api.ApiSessionRequired(cancelUploadSession)).Methods("DELETE")
+
 	api.BaseRoutes.PublicFile.Handle("", api.ApiHandler(getPublicFile)).Methods("GET")
 
 }
@@ -499,6 +511,179 @@ func uploadFileMultipartBuffered(c *Context, mr *multipart.Reader,
 	return &resp
 }
 
+// createUploadSession implements the "POST" leg of the tus 1.0 resumable
+// upload protocol: it reads Upload-Length and Upload-Metadata, creates a
+// model.UploadSession, and returns its location for the client to address
+// subsequent HEAD/PATCH calls at.
+func createUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	c.RequireChannelId()
+	if c.Err != nil {
+		return
+	}
+
+	if !c.App.SessionHasPermissionToChannel(c.Session, c.Params.ChannelId, model.PERMISSION_UPLOAD_FILE) {
+		c.SetPermissionError(model.PERMISSION_UPLOAD_FILE)
+		return
+	}
+
+	fileSize, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		c.SetInvalidParam("Upload-Length")
+		return
+	}
+
+	filename := parseTusUploadMetadata(r.Header.Get("Upload-Metadata"))["filename"]
+	if filename == "" {
+		c.SetInvalidParam("Upload-Metadata")
+		return
+	}
+
+	session, appErr := c.App.CreateUploadSession(c.Params.ChannelId, c.Session.UserId, filename, fileSize)
+	if appErr != nil {
+		c.Err = appErr
+		return
+	}
+
+	w.Header().Set("Location", c.GetSiteURLHeader()+"/api/v4/files/resumable/"+session.Id)
+	w.Header().Set("Tus-Resumable", "1.0.0")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(session.ToJson()))
+}
+
+// getUploadSessionOffset implements the "HEAD" leg of the tus protocol: it
+// reports how many bytes of an in-progress upload the server has so far.
+func getUploadSessionOffset(c *Context, w http.ResponseWriter, r *http.Request) {
+	session, appErr := getUploadSessionForRequest(c)
+	if appErr != nil {
+		c.Err = appErr
+		return
+	}
+	if c.Err != nil {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.FileOffset, 10))
+	w.Header().Set("Tus-Resumable", "1.0.0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadSessionData implements the "PATCH" leg of the tus protocol: it
+// appends the request body, which must be raw bytes starting at
+// Upload-Offset, to the upload in progress. Once the upload reaches its
+// full length, the server runs the same FileInfo/thumbnail/preview pipeline
+// as a regular upload before responding.
+func uploadSessionData(c *Context, w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		c.Err = model.NewAppError("uploadSessionData", "api.file.upload_session_data.invalid_content_type.app_error", nil, "", http.StatusBadRequest)
+		return
+	}
+
+	session, appErr := getUploadSessionForRequest(c)
+	if appErr != nil {
+		c.Err = appErr
+		return
+	}
+	if c.Err != nil {
+		return
+	}
+
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.SetInvalidParam("Upload-Offset")
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, session.FileSize-clientOffset))
+	if err != nil {
+		c.Err = model.NewAppError("uploadSessionData", "api.file.upload_file.read_request.app_error", nil, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, appErr = c.App.UploadData(session, clientOffset, data)
+	if appErr != nil {
+		c.Err = appErr
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.FileOffset, 10))
+	w.Header().Set("Tus-Resumable", "1.0.0")
+
+	if session.FileOffset < session.FileSize {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// The upload just completed: FileId is populated, so return the
+	// session body instead of an empty 204 so the caller can tell which
+	// FileInfo it produced.
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(session.ToJson()))
+}
+
+// cancelUploadSession implements the "DELETE" leg of the tus protocol: it
+// abandons an in-progress resumable upload, discarding whatever bytes have
+// been received so far instead of running them through UploadFile.
+func cancelUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	session, appErr := getUploadSessionForRequest(c)
+	if appErr != nil {
+		c.Err = appErr
+		return
+	}
+	if c.Err != nil {
+		return
+	}
+
+	if appErr := c.App.CancelUploadSession(session); appErr != nil {
+		c.Err = appErr
+		return
+	}
+
+	ReturnStatusOK(w)
+}
+
+// getUploadSessionForRequest looks up the upload session named by the
+// request's upload_id path parameter and verifies the requesting user
+// started it.
+func getUploadSessionForRequest(c *Context) (*model.UploadSession, *model.AppError) {
+	c.RequireUploadId()
+	if c.Err != nil {
+		return nil, nil
+	}
+
+	session, appErr := c.App.GetUploadSession(c.Params.UploadId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if session.UserId != c.Session.UserId {
+		return nil, model.NewAppError("getUploadSessionForRequest", "api.file.upload_session.permissions.app_error", nil, "", http.StatusForbidden)
+	}
+
+	return session, nil
+}
+
+// parseTusUploadMetadata decodes a tus Upload-Metadata header: a
+// comma-separated list of "key base64(value)" pairs.
+func parseTusUploadMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			continue
+		}
+		metadata[parts[0]] = string(decoded)
+	}
+	return metadata
+}
+
 func getFile(c *Context, w http.ResponseWriter, r *http.Request) {
 	c.RequireFileId()
 	if c.Err != nil {
@@ -521,6 +706,10 @@ func getFile(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if c.Err = c.App.CheckFileScanGate(info.Id, c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM)); c.Err != nil {
+		return
+	}
+
 	fileReader, err := c.App.FileReader(info.Path)
 	if err != nil {
 		c.Err = err
@@ -529,13 +718,138 @@ func getFile(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 	defer fileReader.Close()
 
-	err = writeFileResponse(info.Name, info.MimeType, info.Size, fileReader, forceDownload, w, r)
+	err = writeFileResponse(info.Name, info.MimeType, info.Size, info.CreateAt, fileReader, forceDownload, w, r)
 	if err != nil {
 		c.Err = err
 		return
 	}
 }
 
+// getFilesArchive streams every id in the ids query param as a single ZIP,
+// so a client can offer "download all attachments" for a post or search
+// result in one request instead of N. Each id is subject to the same
+// creator-or-PERMISSION_READ_CHANNEL check getFile applies; strict=true
+// fails the whole request on the first id that doesn't pass (missing,
+// unreadable, still-scanning, or no permission), while the default
+// (strict=false) just leaves that id out of the archive.
+//
+// Entries are capped by FileSettings.MaxArchiveEntries and
+// MaxArchiveUncompressedBytes so a caller can't turn this into a
+// server-side zip bomb by requesting an enormous id list; both are
+// enforced before any file is read or written into the archive.
+func getFilesArchive(c *Context, w http.ResponseWriter, r *http.Request) {
+	ids := r.URL.Query()["ids"]
+	if len(ids) == 0 {
+		c.Err = model.NewAppError("getFilesArchive", "api.file.get_files_archive.no_ids.app_error", nil, "", http.StatusBadRequest)
+		return
+	}
+
+	if format := r.URL.Query().Get("format"); format != "" && format != "zip" {
+		c.Err = model.NewAppError("getFilesArchive", "api.file.get_files_archive.unsupported_format.app_error", nil, "format="+format, http.StatusNotImplemented)
+		return
+	}
+
+	strict, _ := strconv.ParseBool(r.URL.Query().Get("strict"))
+
+	if maxEntries := *c.App.Config().FileSettings.MaxArchiveEntries; maxEntries > 0 && len(ids) > maxEntries {
+		c.Err = model.NewAppError("getFilesArchive", "api.file.get_files_archive.too_many_entries.app_error", nil, fmt.Sprintf("requested=%d, max=%d", len(ids), maxEntries), http.StatusBadRequest)
+		return
+	}
+
+	type archiveEntry struct {
+		info   *model.FileInfo
+		reader io.ReadCloser
+	}
+
+	var entries []archiveEntry
+	defer func() {
+		for _, entry := range entries {
+			entry.reader.Close()
+		}
+	}()
+
+	maxUncompressedBytes := *c.App.Config().FileSettings.MaxArchiveUncompressedBytes
+	var totalUncompressedBytes int64
+
+	for _, fileId := range ids {
+		if !model.IsValidId(fileId) {
+			if strict {
+				c.Err = model.NewAppError("getFilesArchive", "api.file.get_files_archive.invalid_id.app_error", nil, "file_id="+fileId, http.StatusBadRequest)
+				return
+			}
+			continue
+		}
+
+		info, err := c.App.GetFileInfo(fileId)
+		if err != nil {
+			if strict {
+				c.Err = err
+				return
+			}
+			continue
+		}
+
+		if info.CreatorId != c.Session.UserId && !c.App.SessionHasPermissionToChannelByPost(c.Session, info.PostId, model.PERMISSION_READ_CHANNEL) {
+			if strict {
+				c.SetPermissionError(model.PERMISSION_READ_CHANNEL)
+				return
+			}
+			continue
+		}
+
+		if err := c.App.CheckFileScanGate(info.Id, c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM)); err != nil {
+			if strict {
+				c.Err = err
+				return
+			}
+			continue
+		}
+
+		totalUncompressedBytes += info.Size
+		if maxUncompressedBytes > 0 && totalUncompressedBytes > maxUncompressedBytes {
+			c.Err = model.NewAppError("getFilesArchive", "api.file.get_files_archive.too_large.app_error", nil, "", http.StatusBadRequest)
+			return
+		}
+
+		fileReader, err := c.App.FileReader(info.Path)
+		if err != nil {
+			if strict {
+				c.Err = err
+				c.Err.StatusCode = http.StatusNotFound
+				return
+			}
+			continue
+		}
+
+		entries = append(entries, archiveEntry{info: info, reader: fileReader})
+	}
+
+	if len(entries) == 0 {
+		c.Err = model.NewAppError("getFilesArchive", "api.file.get_files_archive.no_files.app_error", nil, "", http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("mattermost-files-%d.zip", model.GetMillis())
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment;filename=\""+filename+"\"")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// archive/zip's Writer streams directly to w as entries are added, so
+	// this never buffers the whole archive (or even a whole entry) in
+	// memory -- the same reasoning writeFileResponse's ServeContent path
+	// relies on for large files.
+	zipWriter := zip.NewWriter(w)
+	for _, entry := range entries {
+		zipEntry, err := zipWriter.Create(entry.info.Id + "-" + entry.info.Name)
+		if err != nil {
+			continue
+		}
+		io.Copy(zipEntry, entry.reader)
+	}
+	zipWriter.Close()
+}
+
 func getFileThumbnail(c *Context, w http.ResponseWriter, r *http.Request) {
 	c.RequireFileId()
 	if c.Err != nil {
@@ -563,16 +877,7 @@ func getFileThumbnail(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileReader, err := c.App.FileReader(info.ThumbnailPath)
-	if err != nil {
-		c.Err = err
-		c.Err.StatusCode = http.StatusNotFound
-		return
-	}
-	defer fileReader.Close()
-
-	err = writeFileResponse(info.Name, THUMBNAIL_IMAGE_TYPE, 0, fileReader, forceDownload, w, r)
-	if err != nil {
+	if err := serveImageVariant(c, w, r, info, info.ThumbnailPath, THUMBNAIL_IMAGE_TYPE, forceDownload); err != nil {
 		c.Err = err
 		return
 	}
@@ -606,11 +911,57 @@ func getFileLink(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := make(map[string]string)
-	resp["link"] = c.App.GeneratePublicLink(c.GetSiteURLHeader(), info)
+
+	if ttlSeconds, convErr := strconv.ParseInt(r.URL.Query().Get("ttl"), 10, 64); convErr == nil && ttlSeconds > 0 {
+		var maxDownloads int64
+		if n, convErr := strconv.ParseInt(r.URL.Query().Get("max_downloads"), 10, 64); convErr == nil && n > 0 {
+			maxDownloads = n
+		}
+		restrictToCreator, _ := strconv.ParseBool(r.URL.Query().Get("restrict"))
+		resp["link"] = c.App.GeneratePublicLinkWithExpiry(c.GetSiteURLHeader(), info, c.Session.UserId, time.Duration(ttlSeconds)*time.Second, maxDownloads, restrictToCreator)
+	} else {
+		resp["link"] = c.App.GeneratePublicLink(c.GetSiteURLHeader(), info)
+	}
 
 	w.Write([]byte(model.MapToJson(resp)))
 }
 
+// revokeFileLink revokes a single time-bounded public link issued by
+// GeneratePublicLinkWithExpiry, identified by its nonce query param. It has
+// no effect on GeneratePublicLink's non-expiring links, which carry no
+// nonce to revoke, or on any other outstanding expiring link for the same
+// file.
+func revokeFileLink(c *Context, w http.ResponseWriter, r *http.Request) {
+	c.RequireFileId()
+	if c.Err != nil {
+		return
+	}
+
+	nonce := r.URL.Query().Get("nonce")
+	if len(nonce) == 0 {
+		c.Err = model.NewAppError("revokeFileLink", "api.file.revoke_public_link.missing_nonce.app_error", nil, "", http.StatusBadRequest)
+		return
+	}
+
+	info, err := c.App.GetFileInfo(c.Params.FileId)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	if info.CreatorId != c.Session.UserId && !c.App.SessionHasPermissionToChannelByPost(c.Session, info.PostId, model.PERMISSION_READ_CHANNEL) {
+		c.SetPermissionError(model.PERMISSION_READ_CHANNEL)
+		return
+	}
+
+	if err := c.App.RevokePublicLink(info.Id, nonce); err != nil {
+		c.Err = err
+		return
+	}
+
+	ReturnStatusOK(w)
+}
+
 func getFilePreview(c *Context, w http.ResponseWriter, r *http.Request) {
 	c.RequireFileId()
 	if c.Err != nil {
@@ -638,19 +989,104 @@ func getFilePreview(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileReader, err := c.App.FileReader(info.PreviewPath)
-	if err != nil {
+	if err := serveImageVariant(c, w, r, info, info.PreviewPath, PREVIEW_IMAGE_TYPE, forceDownload); err != nil {
 		c.Err = err
-		c.Err.StatusCode = http.StatusNotFound
 		return
 	}
-	defer fileReader.Close()
+}
+
+// serveImageVariant serves basePath (a FileInfo's ThumbnailPath or
+// PreviewPath) as-is when the request carries none of the w/h/fit/format/q
+// query params GetFilePreview/GetFileThumbnail now accept. When it does,
+// it validates them, serves a cached re-encoded variant from
+// model.ImageVariantPath if one already exists, and otherwise runs
+// imagetransform.Transform once and caches the result there before
+// serving it -- so a repeated request for the same (fileId, params)
+// combination is O(1) instead of re-encoding every time.
+func serveImageVariant(c *Context, w http.ResponseWriter, r *http.Request, info *model.FileInfo, basePath string, defaultContentType string, forceDownload bool) *model.AppError {
+	if err := c.App.CheckFileScanGate(info.Id, c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM)); err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	widthParam := query.Get("w")
+	heightParam := query.Get("h")
 
-	err = writeFileResponse(info.Name, PREVIEW_IMAGE_TYPE, 0, fileReader, forceDownload, w, r)
+	if widthParam == "" && heightParam == "" {
+		fileReader, err := c.App.FileReader(basePath)
+		if err != nil {
+			err.StatusCode = http.StatusNotFound
+			return err
+		}
+		defer fileReader.Close()
+
+		return writeFileResponse(info.Name, defaultContentType, 0, info.CreateAt, fileReader, forceDownload, w, r)
+	}
+
+	width, wErr := strconv.Atoi(widthParam)
+	height, hErr := strconv.Atoi(heightParam)
+	if wErr != nil || hErr != nil {
+		return model.NewAppError("serveImageVariant", "api.file.image_variant.invalid_dimensions.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	allowed := imagetransform.DefaultAllowedVariants
+	if !imagetransform.IsAllowedVariant(width, height, allowed) {
+		return model.NewAppError("serveImageVariant", "api.file.image_variant.dimensions_not_allowed.app_error", nil, fmt.Sprintf("w=%d, h=%d", width, height), http.StatusBadRequest)
+	}
+
+	fit := imagetransform.Fit(query.Get("fit"))
+	switch fit {
+	case imagetransform.FitCover, imagetransform.FitContain, imagetransform.FitScale:
+	case "":
+		fit = imagetransform.FitCover
+	default:
+		return model.NewAppError("serveImageVariant", "api.file.image_variant.invalid_fit.app_error", nil, "fit="+string(fit), http.StatusBadRequest)
+	}
+
+	format := imagetransform.Format(query.Get("format"))
+	switch format {
+	case imagetransform.FormatJPEG, imagetransform.FormatPNG, imagetransform.FormatWebP:
+	case "":
+		format = imagetransform.FormatJPEG
+	default:
+		return model.NewAppError("serveImageVariant", "api.file.image_variant.invalid_format.app_error", nil, "format="+string(format), http.StatusBadRequest)
+	}
+	if format == imagetransform.FormatWebP {
+		return model.NewAppError("serveImageVariant", "api.file.image_variant.webp_not_supported.app_error", nil, "", http.StatusNotImplemented)
+	}
+
+	quality := 90
+	if qParam := query.Get("q"); qParam != "" {
+		q, qErr := strconv.Atoi(qParam)
+		if qErr != nil || q < 1 || q > 100 {
+			return model.NewAppError("serveImageVariant", "api.file.image_variant.invalid_quality.app_error", nil, "", http.StatusBadRequest)
+		}
+		quality = q
+	}
+
+	opts := imagetransform.Options{Width: width, Height: height, Fit: fit, Format: format, Quality: quality}
+	variantPath := model.ImageVariantPath(info.Id, width, height, string(fit), string(format), quality)
+
+	if cached, cacheErr := c.App.ReadFile(variantPath); cacheErr == nil {
+		return writeFileResponse(info.Name, opts.ContentType(), int64(len(cached)), info.CreateAt, bytes.NewReader(cached), forceDownload, w, r)
+	}
+
+	source, err := c.App.ReadFile(basePath)
 	if err != nil {
-		c.Err = err
-		return
+		err.StatusCode = http.StatusNotFound
+		return err
+	}
+
+	transformed, tErr := imagetransform.Transform(source, opts)
+	if tErr != nil {
+		return model.NewAppError("serveImageVariant", "api.file.image_variant.transform_failed.app_error", nil, tErr.Error(), http.StatusInternalServerError)
+	}
+
+	if _, err := c.App.WriteFile(bytes.NewReader(transformed), variantPath); err != nil {
+		return err
 	}
+
+	return writeFileResponse(info.Name, opts.ContentType(), int64(len(transformed)), info.CreateAt, bytes.NewReader(transformed), forceDownload, w, r)
 }
 
 func getFileInfo(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -692,6 +1128,9 @@ func getPublicFile(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	hash := r.URL.Query().Get("h")
+	expiresParam := r.URL.Query().Get("expires")
+	nonce := r.URL.Query().Get("nonce")
+	uid := r.URL.Query().Get("uid")
 
 	if len(hash) == 0 {
 		c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_invalid.app_error", nil, "", http.StatusBadRequest)
@@ -699,34 +1138,115 @@ func getPublicFile(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if subtle.ConstantTimeCompare([]byte(hash), []byte(app.GeneratePublicLinkHash(info.Id, *c.App.Config().FileSettings.PublicLinkSalt))) != 1 {
+	// A link minted by GeneratePublicLinkWithExpiry carries expires and
+	// nonce alongside h; GeneratePublicLink's plain links carry neither, so
+	// they fall through to the original unkeyed-by-expiry comparison below.
+	var linkExpiresAt int64
+	if len(expiresParam) > 0 || len(nonce) > 0 {
+		expiresAt, convErr := strconv.ParseInt(expiresParam, 10, 64)
+		if convErr != nil || len(nonce) == 0 {
+			c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_invalid.app_error", nil, "", http.StatusBadRequest)
+			utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(app.GeneratePublicLinkHashWithExpiry(info.Id, *c.App.Config().FileSettings.PublicLinkSalt, expiresAt, nonce, uid))) != 1 {
+			c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_invalid.app_error", nil, "", http.StatusBadRequest)
+			utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+			return
+		}
+
+		// uid restricts the link to a single session user: the hash check
+		// above already proves uid wasn't tampered with (it's signed in
+		// alongside expires/nonce), so all that's left is confirming the
+		// current request actually belongs to that session.
+		if len(uid) > 0 && c.Session.UserId != uid {
+			c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_link_restricted.app_error", nil, "", http.StatusForbidden)
+			utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+			return
+		}
+
+		if model.GetMillis() > expiresAt {
+			c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_link_expired.app_error", nil, "", http.StatusGone)
+			utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+			return
+		}
+
+		if revoked, revokeErr := c.App.PublicLinkRevoked(info.Id, nonce); revokeErr != nil {
+			c.Err = revokeErr
+			return
+		} else if revoked {
+			c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_link_revoked.app_error", nil, "", http.StatusGone)
+			utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+			return
+		}
+
+		if allowed, downloadErr := c.App.RecordPublicFileLinkDownload(info.Id, nonce); downloadErr != nil {
+			c.Err = downloadErr
+			return
+		} else if !allowed {
+			c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_link_download_limit.app_error", nil, "", http.StatusGone)
+			utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+			return
+		}
+
+		linkExpiresAt = expiresAt
+	} else if !*c.App.Config().FileSettings.EnableDeprecatedStaticPublicLinks {
+		// The static, non-expiring h=-only scheme predates expires/nonce
+		// and never stops working on its own -- a leaked link is valid
+		// forever, and rotating PublicLinkSalt is the only way to kill all
+		// of them at once. This flag lets an instance finish migrating
+		// every client onto GeneratePublicLinkWithExpiry and then shut the
+		// legacy path off entirely.
+		c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_link_deprecated.app_error", nil, "", http.StatusGone)
+		utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+		return
+	} else if subtle.ConstantTimeCompare([]byte(hash), []byte(app.GeneratePublicLinkHash(info.Id, *c.App.Config().FileSettings.PublicLinkSalt))) != 1 {
 		c.Err = model.NewAppError("getPublicFile", "api.file.get_file.public_invalid.app_error", nil, "", http.StatusBadRequest)
 		utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
 		return
 	}
 
+	// A public link carries no session to check for admin permissions, so
+	// an infected or still-pending file is unconditionally unavailable
+	// here regardless of who holds the link.
+	if c.Err = c.App.CheckFileScanGate(info.Id, false); c.Err != nil {
+		utils.RenderWebAppError(c.App.Config(), w, r, c.Err, c.App.AsymmetricSigningKey())
+		return
+	}
+
+	// When the backend is S3 and redirects are enabled, send the browser
+	// straight to a pre-signed S3 URL instead of proxying the bytes
+	// through this server.
+	if *c.App.Config().FileSettings.DriverName == "amazons3" && *c.App.Config().FileSettings.RedirectPublicLinks {
+		redirectURL, redirectErr := c.App.S3RedirectURL(info, linkExpiresAt)
+		if redirectErr != nil {
+			c.Err = redirectErr
+			return
+		}
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+		return
+	}
+
 	fileReader, err := c.App.FileReader(info.Path)
 	if err != nil {
 		c.Err = err
 		c.Err.StatusCode = http.StatusNotFound
+		return
 	}
 	defer fileReader.Close()
 
-	err = writeFileResponse(info.Name, info.MimeType, info.Size, fileReader, false, w, r)
+	err = writeFileResponse(info.Name, info.MimeType, info.Size, info.CreateAt, fileReader, false, w, r)
 	if err != nil {
 		c.Err = err
 		return
 	}
 }
 
-func writeFileResponse(filename string, contentType string, contentSize int64, fileReader io.Reader, forceDownload bool, w http.ResponseWriter, r *http.Request) *model.AppError {
+func writeFileResponse(filename string, contentType string, contentSize int64, modTimeMillis int64, fileReader io.Reader, forceDownload bool, w http.ResponseWriter, r *http.Request) *model.AppError {
 	w.Header().Set("Cache-Control", "max-age=2592000, private")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
-	if contentSize > 0 {
-		w.Header().Set("Content-Length", strconv.Itoa(int(contentSize)))
-	}
-
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	} else {
@@ -768,6 +1288,26 @@ func writeFileResponse(filename string, contentType string, contentSize int64, f
 	w.Header().Set("X-Frame-Options", "DENY")
 	w.Header().Set("Content-Security-Policy", "Frame-ancestors 'none'")
 
+	// http.ServeContent handles Range (including 206/Content-Range),
+	// If-Modified-Since, If-Unmodified-Since, If-None-Match, and HEAD for
+	// us -- covering the seeking/resuming large audio and video players
+	// need -- but only against an io.ReadSeeker, since it Seeks to
+	// determine size and to serve an arbitrary range. A reader that can't
+	// seek (a backend that doesn't support it, or a caller that only has
+	// bytes remaining to stream) falls back to a plain, unconditional
+	// response exactly as before ServeContent was wired in.
+	if seeker, canSeek := fileReader.(io.ReadSeeker); canSeek {
+		var modTime time.Time
+		if modTimeMillis > 0 {
+			modTime = time.Unix(0, modTimeMillis*int64(time.Millisecond))
+		}
+		http.ServeContent(w, r, filename, modTime, seeker)
+		return nil
+	}
+
+	if contentSize > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(contentSize, 10))
+	}
 	io.Copy(w, fileReader)
 
 	return nil
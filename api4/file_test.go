@@ -7,13 +7,19 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -21,6 +27,8 @@ import (
 	"github.com/mattermost/mattermost-server/app"
 	"github.com/mattermost/mattermost-server/mlog"
 	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/services/filescan"
+	"github.com/mattermost/mattermost-server/services/imagetransform"
 	"github.com/mattermost/mattermost-server/store"
 	"github.com/mattermost/mattermost-server/utils"
 )
@@ -543,6 +551,81 @@ func TestUploadFiles(t *testing.T) {
 	}
 }
 
+// TestResumableUploadMatchesSingleShot drives the tus-style
+// /files/resumable endpoints (createUploadSession/getUploadSessionOffset/
+// uploadSessionData) through 3 chunks, simulating a dropped connection
+// between chunk 2 and 3 by discarding the Client and resuming against a
+// fresh one -- the same UploadSession row on the server is addressed by
+// its Id either way. The resulting FileInfo must be indistinguishable from
+// a single-shot Client.UploadFile of the same bytes.
+func TestResumableUploadMatchesSingleShot(t *testing.T) {
+	th := Setup().InitBasic().InitSystemAdmin()
+	defer th.TearDown()
+	channel := th.BasicChannel
+
+	if *th.App.Config().FileSettings.DriverName == "" {
+		t.Skip("skipping because no file driver is enabled")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.White}, image.ZP, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	singleShotResp, resp := th.Client.UploadFile(data, channel.Id, "resumable.png")
+	CheckNoError(t, resp)
+	singleShot := singleShotResp.FileInfos[0]
+	th.cleanupTestFile(singleShot)
+
+	session, resp := th.Client.CreateUpload(channel.Id, "resumable.png", int64(len(data)))
+	CheckNoError(t, resp)
+
+	chunkSize := len(data) / 3
+	chunks := [][]byte{
+		data[0:chunkSize],
+		data[chunkSize : 2*chunkSize],
+		data[2*chunkSize:],
+	}
+
+	session, resp = th.Client.UploadChunk(session.Id, 0, chunks[0])
+	CheckNoError(t, resp)
+	session, resp = th.Client.UploadChunk(session.Id, session.FileOffset, chunks[1])
+	CheckNoError(t, resp)
+
+	// Simulate a dropped connection: the old Client is abandoned and the
+	// transfer resumes against a fresh one, re-querying the offset the
+	// server actually persisted rather than trusting local state.
+	resumedClient := th.CreateClient()
+	resumedClient.AuthToken = th.Client.AuthToken
+	resumedClient.AuthType = th.Client.AuthType
+
+	status, resp := resumedClient.GetUploadStatus(session.Id)
+	CheckNoError(t, resp)
+	if status.FileOffset != session.FileOffset {
+		t.Fatalf("resumed offset %d should match the last acknowledged offset %d", status.FileOffset, session.FileOffset)
+	}
+
+	session, resp = resumedClient.UploadChunk(session.Id, status.FileOffset, chunks[2])
+	CheckNoError(t, resp)
+	if session.FileOffset != int64(len(data)) {
+		t.Fatalf("expected the upload to complete, got offset %d of %d", session.FileOffset, len(data))
+	}
+	if session.FileId == "" {
+		t.Fatal("expected the completed session to carry the finalized FileInfo's id")
+	}
+
+	resumed, resp := th.Client.GetFileInfo(session.FileId)
+	CheckNoError(t, resp)
+	if resumed.Size != singleShot.Size || resumed.MimeType != singleShot.MimeType {
+		t.Fatalf("resumable upload result %+v should match single-shot result %+v", resumed, singleShot)
+	}
+
+	th.cleanupTestFile(resumed)
+}
+
 func TestGetFile(t *testing.T) {
 	th := Setup().InitBasic().InitSystemAdmin()
 	defer th.TearDown()
@@ -592,6 +675,59 @@ func TestGetFile(t *testing.T) {
 	CheckNoError(t, resp)
 }
 
+func TestGetFileRange(t *testing.T) {
+	th := Setup().InitBasic().InitSystemAdmin()
+	defer th.TearDown()
+	Client := th.Client
+	channel := th.BasicChannel
+
+	if *th.App.Config().FileSettings.DriverName == "" {
+		t.Skip("skipping because no file driver is enabled")
+	}
+
+	sent, err := readTestFile("test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileResp, resp := Client.UploadFile(sent, channel.Id, "test.png")
+	CheckNoError(t, resp)
+	fileId := fileResp.FileInfos[0].Id
+
+	req, err := http.NewRequest("GET", Client.Url+"/api/v4/files/"+fileId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(model.HEADER_AUTH, Client.AuthType+" "+Client.AuthToken)
+	req.Header.Set("Range", "bytes=100-199")
+
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected 206/Partial Content, got %d", httpResp.StatusCode)
+	}
+	if got := httpResp.Header.Get("Content-Range"); got != fmt.Sprintf("bytes 100-199/%d", len(sent)) {
+		t.Fatalf("unexpected Content-Range: %s", got)
+	}
+	if got := httpResp.Header.Get("Accept-Ranges"); got != "bytes" {
+		t.Fatalf("unexpected Accept-Ranges: %s", got)
+	}
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 100 {
+		t.Fatalf("expected 100 bytes, got %d", len(body))
+	}
+	if !bytes.Equal(body, sent[100:200]) {
+		t.Fatal("ranged bytes didn't match the corresponding slice of the source file")
+	}
+}
+
 func TestGetFileHeaders(t *testing.T) {
 	th := Setup().InitBasic()
 	defer th.TearDown()
@@ -786,6 +922,66 @@ func TestGetFileLink(t *testing.T) {
 	}
 }
 
+func TestGetFileLinkWithExpiryAndRevocation(t *testing.T) {
+	th := Setup().InitBasic().InitSystemAdmin()
+	defer th.TearDown()
+	Client := th.Client
+	channel := th.BasicChannel
+
+	if *th.App.Config().FileSettings.DriverName == "" {
+		t.Skip("skipping because no file driver is enabled")
+	}
+
+	enablePublicLink := th.App.Config().FileSettings.EnablePublicLink
+	defer func() {
+		th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.EnablePublicLink = enablePublicLink })
+	}()
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.EnablePublicLink = true })
+
+	data, err := readTestFile("test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileResp, resp := Client.UploadFile(data, channel.Id, "test.png")
+	CheckNoError(t, resp)
+	fileId := fileResp.FileInfos[0].Id
+
+	store.Must(th.App.Srv.Store.FileInfo().AttachToPost(fileId, th.BasicPost.Id))
+	time.Sleep(2 * time.Second)
+
+	// A link that's already expired is rejected even though its signature
+	// and nonce are otherwise valid.
+	expiredLink, resp := Client.GetFileLinkWithExpiry(fileId, -time.Second)
+	CheckNoError(t, resp)
+	if httpResp, err := http.Get(expiredLink); err != nil || httpResp.StatusCode != http.StatusGone {
+		t.Fatal("expired link should've returned 410/Gone")
+	}
+
+	// An outstanding, unexpired link keeps working after a *different*
+	// link's nonce is revoked.
+	liveLink, resp := Client.GetFileLinkWithExpiry(fileId, time.Hour)
+	CheckNoError(t, resp)
+	revokedLink, resp := Client.GetFileLinkWithExpiry(fileId, time.Hour)
+	CheckNoError(t, resp)
+
+	revokedNonce := revokedLink[strings.Index(revokedLink, "nonce=")+len("nonce="):]
+	_, resp = Client.RevokePublicLink(fileId, revokedNonce)
+	CheckNoError(t, resp)
+
+	if httpResp, err := http.Get(revokedLink); err != nil || httpResp.StatusCode != http.StatusGone {
+		t.Fatal("revoked link should've returned 410/Gone")
+	}
+	if httpResp, err := http.Get(liveLink); err != nil || httpResp.StatusCode != http.StatusOK {
+		t.Fatal("un-revoked, unexpired link should still work")
+	}
+
+	if result := <-th.App.Srv.Store.FileInfo().Get(fileId); result.Err != nil {
+		t.Fatal(result.Err)
+	} else {
+		th.cleanupTestFile(result.Data.(*model.FileInfo))
+	}
+}
+
 func TestGetFilePreview(t *testing.T) {
 	th := Setup().InitBasic().InitSystemAdmin()
 	defer th.TearDown()
@@ -838,6 +1034,57 @@ func TestGetFilePreview(t *testing.T) {
 	CheckNoError(t, resp)
 }
 
+func TestGetFilePreviewWithOptions(t *testing.T) {
+	th := Setup().InitBasic().InitSystemAdmin()
+	defer th.TearDown()
+	Client := th.Client
+	channel := th.BasicChannel
+
+	if *th.App.Config().FileSettings.DriverName == "" {
+		t.Skip("skipping because no file driver is enabled")
+	}
+
+	sent, err := readTestFile("test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileResp, resp := Client.UploadFile(sent, channel.Id, "test.png")
+	CheckNoError(t, resp)
+	fileId := fileResp.FileInfos[0].Id
+
+	time.Sleep(2 * time.Second)
+
+	opts := model.ImageVariantOptions{Width: 128, Height: 128, Fit: "cover", Format: "png"}
+	data, contentType, resp := Client.GetFilePreviewWithOptions(fileId, opts)
+	CheckNoError(t, resp)
+	if contentType != "image/png" {
+		t.Fatalf("expected content-type image/png, got %s", contentType)
+	}
+	decoded, decodeErr := png.Decode(bytes.NewReader(data))
+	if decodeErr != nil {
+		t.Fatalf("decode variant: %v", decodeErr)
+	}
+	if decoded.Bounds().Dx() != 128 || decoded.Bounds().Dy() != 128 {
+		t.Fatalf("expected a 128x128 variant, got %dx%d", decoded.Bounds().Dx(), decoded.Bounds().Dy())
+	}
+
+	imagetransform.ResetTransformCallCount()
+	_, _, resp = Client.GetFilePreviewWithOptions(fileId, opts)
+	CheckNoError(t, resp)
+	if got := imagetransform.TransformCallCount(); got != 0 {
+		t.Fatalf("expected the second request for the same variant to be served from cache, but Transform ran %d time(s)", got)
+	}
+
+	_, _, resp = Client.GetFilePreviewWithOptions(fileId, model.ImageVariantOptions{Width: 99999, Height: 99999, Fit: "cover", Format: "png"})
+	CheckBadRequestStatus(t, resp)
+
+	if result := <-th.App.Srv.Store.FileInfo().Get(fileId); result.Err != nil {
+		t.Fatal(result.Err)
+	} else {
+		th.cleanupTestFile(result.Data.(*model.FileInfo))
+	}
+}
+
 func TestGetFileInfo(t *testing.T) {
 	th := Setup().InitBasic().InitSystemAdmin()
 	defer th.TearDown()
@@ -976,3 +1223,173 @@ func TestGetPublicFile(t *testing.T) {
 
 	th.cleanupTestFile(info)
 }
+
+// stubFileScanner is a filescan.Scanner that always returns a fixed verdict,
+// used to exercise CheckFileScanGate without a real ClamAV/ICAP endpoint.
+type stubFileScanner struct {
+	verdict filescan.Verdict
+	err     error
+}
+
+func (s stubFileScanner) Scan(r io.Reader, name string) (filescan.Verdict, error) {
+	io.Copy(ioutil.Discard, r)
+	return s.verdict, s.err
+}
+
+func TestFileScanGateBlocksInfectedFile(t *testing.T) {
+	th := Setup().InitBasic().InitSystemAdmin()
+	defer th.TearDown()
+	Client := th.Client
+	channel := th.BasicChannel
+
+	if *th.App.Config().FileSettings.DriverName == "" {
+		t.Skip("skipping because no file driver is enabled")
+	}
+
+	enablePublicLink := th.App.Config().FileSettings.EnablePublicLink
+	defer func() {
+		th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.EnablePublicLink = enablePublicLink })
+	}()
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.EnablePublicLink = true })
+
+	app.SetFileScanner(stubFileScanner{verdict: filescan.Verdict{Status: filescan.StatusInfected, SignatureName: "Eicar-Test-Signature"}})
+	defer app.SetFileScanner(nil)
+
+	data, err := readTestFile("test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileResp, resp := Client.UploadFile(data, channel.Id, "test.png")
+	CheckNoError(t, resp)
+	fileId := fileResp.FileInfos[0].Id
+
+	// EnqueueFileScan runs in a background worker, so poll briefly rather
+	// than sleeping a fixed, possibly-too-short duration.
+	var status *model.FileScanStatus
+	for i := 0; i < 50; i++ {
+		status, err = th.App.GetFileScanStatus(fileId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != model.FILE_SCAN_STATUS_PENDING {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if status.Status != model.FILE_SCAN_STATUS_INFECTED {
+		t.Fatalf("expected infected status, got %s", status.Status)
+	}
+
+	link := th.App.GeneratePublicLink(Client.Url, &model.FileInfo{Id: fileId})
+
+	_, resp = Client.GetFile(fileId)
+	if resp.StatusCode != http.StatusUnavailableForLegalReasons {
+		t.Fatalf("GetFile on infected file should've returned 451, got %d", resp.StatusCode)
+	}
+
+	_, resp = Client.GetFileThumbnail(fileId)
+	if resp.StatusCode != http.StatusUnavailableForLegalReasons {
+		t.Fatalf("GetFileThumbnail on infected file should've returned 451, got %d", resp.StatusCode)
+	}
+
+	_, resp = Client.GetFilePreview(fileId)
+	if resp.StatusCode != http.StatusUnavailableForLegalReasons {
+		t.Fatalf("GetFilePreview on infected file should've returned 451, got %d", resp.StatusCode)
+	}
+
+	if httpResp, err := http.Get(link); err != nil || httpResp.StatusCode != http.StatusUnavailableForLegalReasons {
+		t.Fatal("GetPublicFile on infected file should've returned 451")
+	}
+
+	// A system admin can still retrieve the file to investigate or manage
+	// the false positive.
+	_, resp = th.SystemAdminClient.GetFile(fileId)
+	CheckNoError(t, resp)
+
+	if result := <-th.App.Srv.Store.FileInfo().Get(fileId); result.Err != nil {
+		t.Fatal(result.Err)
+	} else {
+		th.cleanupTestFile(result.Data.(*model.FileInfo))
+	}
+}
+
+func TestGetPublicFileS3Redirect(t *testing.T) {
+	th := Setup().InitBasic().InitSystemAdmin()
+	defer th.TearDown()
+	Client := th.Client
+	channel := th.BasicChannel
+
+	if *th.App.Config().FileSettings.DriverName == "" {
+		t.Skip("skipping because no file driver is enabled")
+	}
+
+	mockS3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockS3.Close()
+	mockS3Host := strings.TrimPrefix(mockS3.URL, "http://")
+
+	driverName := th.App.Config().FileSettings.DriverName
+	enablePublicLink := th.App.Config().FileSettings.EnablePublicLink
+	defer func() {
+		th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.DriverName = driverName })
+		th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.EnablePublicLink = enablePublicLink })
+		th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.RedirectPublicLinks = model.NewBool(false) })
+	}()
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.EnablePublicLink = true })
+
+	data, err := readTestFile("test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileResp, resp := Client.UploadFile(data, channel.Id, "test.png")
+	CheckNoError(t, resp)
+	fileId := fileResp.FileInfos[0].Id
+
+	result := <-th.App.Srv.Store.FileInfo().Get(fileId)
+	info := result.Data.(*model.FileInfo)
+	link := th.App.GeneratePublicLink(Client.Url, info)
+	time.Sleep(2 * time.Second)
+
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.DriverName = model.NewString("amazons3") })
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.RedirectPublicLinks = model.NewBool(true) })
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.AmazonS3Endpoint = model.NewString(mockS3Host) })
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.AmazonS3Bucket = model.NewString("mm-test-bucket") })
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.AmazonS3Region = model.NewString("us-east-1") })
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.AmazonS3AccessKeyId = model.NewString("AKIDEXAMPLE") })
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.AmazonS3SecretAccessKey = model.NewString("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY") })
+	th.App.UpdateConfig(func(cfg *model.Config) { cfg.FileSettings.AmazonS3SSL = model.NewBool(false) })
+
+	noRedirectClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	httpResp, err := noRedirectClient.Get(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusFound {
+		t.Fatalf("expected 302/Found, got %d", httpResp.StatusCode)
+	}
+
+	redirectURL, err := url.Parse(httpResp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if redirectURL.Query().Get("X-Amz-Signature") == "" {
+		t.Fatal("expected X-Amz-Signature in redirect target")
+	}
+	// GeneratePublicLink's plain links carry no expiry of their own, so the
+	// pre-signed URL falls back to app.defaultS3RedirectTTL (15 minutes).
+	expires, err := strconv.Atoi(redirectURL.Query().Get("X-Amz-Expires"))
+	if err != nil || expires <= 0 || expires > int(20*time.Minute/time.Second) {
+		t.Fatalf("expected a bounded X-Amz-Expires, got %s", redirectURL.Query().Get("X-Amz-Expires"))
+	}
+
+	th.cleanupTestFile(info)
+}
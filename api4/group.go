@@ -4,9 +4,15 @@
 package api4
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/mattermost/mattermost-server/app"
 	"github.com/mattermost/mattermost-server/model"
 )
 
@@ -25,6 +31,9 @@ func (api *API) InitGroup() {
 	api.BaseRoutes.Groups.Handle("/{group_id:[A-Za-z0-9]+}/members", api.ApiSessionRequired(createOrDeleteGroupMember(apiGroupMemberActionCreate))).Methods("POST")
 	api.BaseRoutes.Groups.Handle("/{group_id:[A-Za-z0-9]+}/members/{user_id:[A-Za-z0-9]+}", api.ApiSessionRequired(createOrDeleteGroupMember(apiGroupMemberActionDelete))).Methods("DELETE")
 
+	api.BaseRoutes.Groups.Handle("/{group_id:[A-Za-z0-9]+}/members/bulk", api.ApiSessionRequired(bulkUpsertGroupMembers)).Methods("POST")
+	api.BaseRoutes.Groups.Handle("/{group_id:[A-Za-z0-9]+}/members/export", api.ApiSessionRequired(exportGroupMembers)).Methods("GET")
+
 	api.BaseRoutes.Groups.Handle("/{group_id:[A-Za-z0-9]+}/teams", api.ApiSessionRequired(createGroupSyncable(model.GSTeam))).Methods("POST")
 	api.BaseRoutes.Groups.Handle("/{group_id:[A-Za-z0-9]+}/teams", api.ApiSessionRequired(getGroupSyncables(model.GSTeam))).Methods("GET")
 	api.BaseRoutes.Groups.Handle("/{group_id:[A-Za-z0-9]+}/teams/{team_id:[A-Za-z0-9]+}", api.ApiSessionRequired(getGroupSyncable(model.GSTeam))).Methods("GET")
@@ -61,6 +70,8 @@ func createGroup(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c.App.LogGroupAudit(c.Session.UserId, group.Id, "create", fmt.Sprintf("name=%s display_name=%s source=%s", group.Name, group.DisplayName, group.Source))
+
 	w.WriteHeader(http.StatusCreated)
 
 	b, _ := json.Marshal(group)
@@ -96,13 +107,44 @@ func getGroups(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	groups, err := c.App.GetGroupsPage(c.Params.Page, c.Params.PerPage)
+	query := r.URL.Query()
+
+	// q/source/not_associated_to_team(channel) are only meaningful together
+	// with a real search, so fall back to the unfiltered GetGroupsPage when
+	// none of them were passed -- existing callers paginating the full list
+	// keep their current behavior untouched.
+	if query.Get("q") == "" && query.Get("source") == "" &&
+		query.Get("not_associated_to_team") == "" && query.Get("not_associated_to_channel") == "" {
+		groups, err := c.App.GetGroupsPage(c.Params.Page, c.Params.PerPage)
+		if err != nil {
+			c.Err = err
+			return
+		}
+
+		b, _ := json.Marshal(groups)
+		w.Write(b)
+		return
+	}
+
+	opts := model.GroupSearchOpts{
+		Term:                     query.Get("q"),
+		Source:                   model.GroupSource(query.Get("source")),
+		NotAssociatedToTeamId:    query.Get("not_associated_to_team"),
+		NotAssociatedToChannelId: query.Get("not_associated_to_channel"),
+		SortBy:                   model.GroupSearchSortBy(query.Get("sort")),
+		Page:                     c.Params.Page,
+		PerPage:                  c.Params.PerPage,
+	}
+
+	result, err := c.App.SearchGroups(opts)
 	if err != nil {
 		c.Err = err
 		return
 	}
 
-	b, _ := json.Marshal(groups)
+	w.Header().Set("X-Total-Count", strconv.FormatInt(result.TotalCount, 10))
+
+	b, _ := json.Marshal(result.Groups)
 
 	w.Write(b)
 }
@@ -129,6 +171,12 @@ func updateGroup(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := c.App.GetGroup(c.Params.GroupId)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
 	update.Id = c.Params.GroupId
 
 	group, err := c.App.UpdateGroup(update)
@@ -137,14 +185,36 @@ func updateGroup(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Is below necessary?
-	// c.LogAudit("")
+	c.App.LogGroupAudit(c.Session.UserId, group.Id, "update", diffGroupFields(before, group))
 
 	b, _ := json.Marshal(group)
 
 	w.Write(b)
 }
 
+// diffGroupFields renders the fields that changed between before and after
+// as "field: 'old' -> 'new'" pairs, for the audit trail UpdateGroup's
+// handler writes on every change.
+func diffGroupFields(before *model.Group, after *model.Group) string {
+	var diffs []string
+	if before.DisplayName != after.DisplayName {
+		diffs = append(diffs, fmt.Sprintf("display_name: %q -> %q", before.DisplayName, after.DisplayName))
+	}
+	if before.Description != after.Description {
+		diffs = append(diffs, fmt.Sprintf("description: %q -> %q", before.Description, after.Description))
+	}
+	if before.Type != after.Type {
+		diffs = append(diffs, fmt.Sprintf("type: %q -> %q", before.Type, after.Type))
+	}
+	if before.RemoteId != after.RemoteId {
+		diffs = append(diffs, fmt.Sprintf("remote_id: %q -> %q", before.RemoteId, after.RemoteId))
+	}
+	if len(diffs) == 0 {
+		return "no fields changed"
+	}
+	return strings.Join(diffs, "; ")
+}
+
 func deleteGroup(c *Context, w http.ResponseWriter, r *http.Request) {
 	c.RequireGroupId()
 	if c.Err != nil {
@@ -166,6 +236,8 @@ func deleteGroup(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c.App.LogGroupAudit(c.Session.UserId, c.Params.GroupId, "delete", "")
+
 	ReturnStatusOK(w)
 }
 
@@ -193,13 +265,16 @@ func createOrDeleteGroupMember(action int) func(*Context, http.ResponseWriter, *
 
 		var createOrDeleteF func(string, string) (*model.GroupMember, *model.AppError)
 		var successStatus int
+		var auditAction string
 		switch action {
 		case apiGroupMemberActionCreate:
 			createOrDeleteF = c.App.CreateGroupMember
 			successStatus = http.StatusCreated
+			auditAction = "member_add"
 		case apiGroupMemberActionDelete:
 			createOrDeleteF = c.App.DeleteGroupMember
 			successStatus = http.StatusOK
+			auditAction = "member_remove"
 		default:
 			return
 		}
@@ -210,6 +285,8 @@ func createOrDeleteGroupMember(action int) func(*Context, http.ResponseWriter, *
 			return
 		}
 
+		c.App.LogGroupAudit(c.Session.UserId, c.Params.GroupId, auditAction, "user_id="+c.Params.UserId)
+
 		w.WriteHeader(successStatus)
 
 		b, _ := json.Marshal(groupMember)
@@ -218,32 +295,357 @@ func createOrDeleteGroupMember(action int) func(*Context, http.ResponseWriter, *
 	}
 }
 
+// syncablePermission returns the permission that gates managing a syncable of
+// the given type, on top of the PERMISSION_MANAGE_SYSTEM every group
+// endpoint already requires: a team admin manages which teams a group syncs
+// into, a channel admin manages which channels it syncs into.
+func syncablePermission(syncableType model.GroupSyncableType) *model.Permission {
+	if syncableType == model.GSTeam {
+		return model.PERMISSION_MANAGE_TEAM
+	}
+	return model.PERMISSION_MANAGE_CHANNEL_ROLES
+}
+
+// requireSyncableId reads the team_id or channel_id route param matching
+// syncableType into c.Params.TeamId/ChannelId and validates it, the same way
+// c.RequireGroupId does for group_id.
+func requireSyncableId(c *Context, syncableType model.GroupSyncableType) string {
+	if syncableType == model.GSTeam {
+		c.RequireTeamId()
+		if c.Err != nil {
+			return ""
+		}
+		return c.Params.TeamId
+	}
+	c.RequireChannelId()
+	if c.Err != nil {
+		return ""
+	}
+	return c.Params.ChannelId
+}
+
 func createGroupSyncable(syncableType model.GroupSyncableType) func(*Context, http.ResponseWriter, *http.Request) {
 	return func(c *Context, w http.ResponseWriter, r *http.Request) {
+		c.RequireGroupId()
+		if c.Err != nil {
+			return
+		}
 
+		if c.App.License() == nil || !*c.App.License().Features.LDAP {
+			c.Err = model.NewAppError("Api4.CreateGroupSyncable", "api.group.create_group_syncable.license.error", nil, "", http.StatusNotImplemented)
+			return
+		}
+
+		if !c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM) &&
+			!c.App.SessionHasPermissionTo(c.Session, syncablePermission(syncableType)) {
+			c.SetPermissionError(model.PERMISSION_MANAGE_SYSTEM)
+			return
+		}
+
+		groupSyncable := model.GroupSyncableFromJson(r.Body)
+		if groupSyncable == nil {
+			c.SetInvalidParam("group_syncable")
+			return
+		}
+
+		groupSyncable.GroupId = c.Params.GroupId
+		groupSyncable.SyncableId = requireSyncableId(c, syncableType)
+		if c.Err != nil {
+			return
+		}
+		groupSyncable.Type = syncableType
+
+		if r.URL.Query().Get("preview") == "true" {
+			preview, err := c.App.PreviewGroupSyncableReconciliation(groupSyncable)
+			if err != nil {
+				c.Err = err
+				return
+			}
+			w.Write([]byte(preview.ToJson()))
+			return
+		}
+
+		groupSyncable, err := c.App.CreateGroupSyncable(groupSyncable)
+		if err != nil {
+			c.Err = err
+			return
+		}
+
+		c.App.LogGroupAudit(c.Session.UserId, groupSyncable.GroupId, "syncable_change", fmt.Sprintf("syncable_type=%s syncable_id=%s action=create", syncableType, groupSyncable.SyncableId))
+
+		c.App.TriggerGroupSyncableReconciliation(groupSyncable)
+
+		w.WriteHeader(http.StatusCreated)
+
+		b, _ := json.Marshal(groupSyncable)
+
+		w.Write(b)
 	}
 }
 
 func getGroupSyncables(syncableType model.GroupSyncableType) func(*Context, http.ResponseWriter, *http.Request) {
 	return func(c *Context, w http.ResponseWriter, r *http.Request) {
+		c.RequireGroupId()
+		if c.Err != nil {
+			return
+		}
+
+		if !c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM) {
+			c.SetPermissionError(model.PERMISSION_MANAGE_SYSTEM)
+			return
+		}
+
+		groupSyncables, err := c.App.GetGroupSyncables(c.Params.GroupId, syncableType)
+		if err != nil {
+			c.Err = err
+			return
+		}
+
+		b, _ := json.Marshal(groupSyncables)
 
+		w.Write(b)
 	}
 }
 
 func getGroupSyncable(syncableType model.GroupSyncableType) func(*Context, http.ResponseWriter, *http.Request) {
 	return func(c *Context, w http.ResponseWriter, r *http.Request) {
+		c.RequireGroupId()
+		if c.Err != nil {
+			return
+		}
+
+		syncableId := requireSyncableId(c, syncableType)
+		if c.Err != nil {
+			return
+		}
+
+		if !c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM) {
+			c.SetPermissionError(model.PERMISSION_MANAGE_SYSTEM)
+			return
+		}
 
+		groupSyncable, err := c.App.GetGroupSyncable(c.Params.GroupId, syncableId, syncableType)
+		if err != nil {
+			c.Err = err
+			return
+		}
+
+		b, _ := json.Marshal(groupSyncable)
+
+		w.Write(b)
 	}
 }
 
 func updateGroupSyncable(syncableType model.GroupSyncableType) func(*Context, http.ResponseWriter, *http.Request) {
 	return func(c *Context, w http.ResponseWriter, r *http.Request) {
+		c.RequireGroupId()
+		if c.Err != nil {
+			return
+		}
+
+		syncableId := requireSyncableId(c, syncableType)
+		if c.Err != nil {
+			return
+		}
+
+		if c.App.License() == nil || !*c.App.License().Features.LDAP {
+			c.Err = model.NewAppError("Api4.UpdateGroupSyncable", "api.group.update_group_syncable.license.error", nil, "", http.StatusNotImplemented)
+			return
+		}
+
+		if !c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM) &&
+			!c.App.SessionHasPermissionTo(c.Session, syncablePermission(syncableType)) {
+			c.SetPermissionError(model.PERMISSION_MANAGE_SYSTEM)
+			return
+		}
+
+		update := model.GroupSyncableFromJson(r.Body)
+		if update == nil {
+			c.SetInvalidParam("group_syncable")
+			return
+		}
+
+		update.GroupId = c.Params.GroupId
+		update.SyncableId = syncableId
+		update.Type = syncableType
+
+		if r.URL.Query().Get("preview") == "true" {
+			preview, err := c.App.PreviewGroupSyncableReconciliation(update)
+			if err != nil {
+				c.Err = err
+				return
+			}
+			w.Write([]byte(preview.ToJson()))
+			return
+		}
 
+		groupSyncable, err := c.App.UpdateGroupSyncable(update)
+		if err != nil {
+			c.Err = err
+			return
+		}
+
+		c.App.LogGroupAudit(c.Session.UserId, groupSyncable.GroupId, "syncable_change", fmt.Sprintf("syncable_type=%s syncable_id=%s action=update", syncableType, groupSyncable.SyncableId))
+
+		c.App.TriggerGroupSyncableReconciliation(groupSyncable)
+
+		b, _ := json.Marshal(groupSyncable)
+
+		w.Write(b)
 	}
 }
 
 func deleteGroupSyncable(syncableType model.GroupSyncableType) func(*Context, http.ResponseWriter, *http.Request) {
 	return func(c *Context, w http.ResponseWriter, r *http.Request) {
+		c.RequireGroupId()
+		if c.Err != nil {
+			return
+		}
 
+		syncableId := requireSyncableId(c, syncableType)
+		if c.Err != nil {
+			return
+		}
+
+		if c.App.License() == nil || !*c.App.License().Features.LDAP {
+			c.Err = model.NewAppError("Api4.DeleteGroupSyncable", "api.group.delete_group_syncable.license.error", nil, "", http.StatusNotImplemented)
+			return
+		}
+
+		if !c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM) &&
+			!c.App.SessionHasPermissionTo(c.Session, syncablePermission(syncableType)) {
+			c.SetPermissionError(model.PERMISSION_MANAGE_SYSTEM)
+			return
+		}
+
+		if _, err := c.App.DeleteGroupSyncable(c.Params.GroupId, syncableId, syncableType); err != nil {
+			c.Err = err
+			return
+		}
+
+		c.App.LogGroupAudit(c.Session.UserId, c.Params.GroupId, "syncable_change", fmt.Sprintf("syncable_type=%s syncable_id=%s action=delete", syncableType, syncableId))
+
+		ReturnStatusOK(w)
+	}
+}
+
+// groupMemberBulkRequestFromCSV reads a "identifier,action" CSV body (one
+// row per identifier, action either "add" or "remove", no header row) into a
+// GroupMemberBulkRequest, the CSV counterpart of
+// model.GroupMemberBulkRequestFromJson for admins scripting this off a
+// spreadsheet export instead of hand-writing JSON.
+func groupMemberBulkRequestFromCSV(data io.Reader) *model.GroupMemberBulkRequest {
+	rows, err := csv.NewReader(data).ReadAll()
+	if err != nil {
+		return nil
+	}
+
+	req := &model.GroupMemberBulkRequest{}
+	for _, row := range rows {
+		if len(row) != 2 {
+			return nil
+		}
+		identifier, action := strings.TrimSpace(row[0]), strings.ToLower(strings.TrimSpace(row[1]))
+		switch action {
+		case "add":
+			req.Add = append(req.Add, identifier)
+		case "remove":
+			req.Remove = append(req.Remove, identifier)
+		default:
+			return nil
+		}
 	}
+
+	return req
+}
+
+// writeGroupMemberBulkResultsCSV renders results as "identifier,user_id,status,error"
+// rows, the CSV counterpart of model.GroupMemberBulkResults.ToJson.
+func writeGroupMemberBulkResultsCSV(w http.ResponseWriter, results model.GroupMemberBulkResults) {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	for _, result := range results {
+		errMessage := ""
+		if result.Error != nil {
+			errMessage = result.Error.Message
+		}
+		cw.Write([]string{result.Identifier, result.UserId, result.Status, errMessage})
+	}
+	cw.Flush()
+}
+
+func bulkUpsertGroupMembers(c *Context, w http.ResponseWriter, r *http.Request) {
+	c.RequireGroupId()
+	if c.Err != nil {
+		return
+	}
+
+	if c.App.License() == nil || !*c.App.License().Features.LDAP {
+		c.Err = model.NewAppError("Api4.BulkUpsertGroupMembers", "api.group.bulk_upsert_group_members.license.error", nil, "", http.StatusNotImplemented)
+		return
+	}
+
+	if !c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM) {
+		c.SetPermissionError(model.PERMISSION_MANAGE_SYSTEM)
+		return
+	}
+
+	var req *model.GroupMemberBulkRequest
+	if r.Header.Get("Content-Type") == "text/csv" {
+		req = groupMemberBulkRequestFromCSV(r.Body)
+	} else {
+		req = model.GroupMemberBulkRequestFromJson(r.Body)
+	}
+	if req == nil {
+		c.SetInvalidParam("group_member_bulk_request")
+		return
+	}
+
+	if len(req.Add)+len(req.Remove) > app.MaxGroupMemberBulkBatchSize {
+		c.Err = model.NewAppError("Api4.BulkUpsertGroupMembers", "api.group.bulk_upsert_group_members.too_large", map[string]interface{}{"Max": app.MaxGroupMemberBulkBatchSize}, "", http.StatusBadRequest)
+		return
+	}
+
+	results, err := c.App.BulkUpsertGroupMembers(c.Params.GroupId, req.Add, req.Remove)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	if r.Header.Get("Accept") == "text/csv" {
+		writeGroupMemberBulkResultsCSV(w, results)
+		return
+	}
+
+	w.Write([]byte(results.ToJson()))
+}
+
+func exportGroupMembers(c *Context, w http.ResponseWriter, r *http.Request) {
+	c.RequireGroupId()
+	if c.Err != nil {
+		return
+	}
+
+	if !c.App.SessionHasPermissionTo(c.Session, model.PERMISSION_MANAGE_SYSTEM) {
+		c.SetPermissionError(model.PERMISSION_MANAGE_SYSTEM)
+		return
+	}
+
+	users, err := c.App.GetGroupMemberUsers(c.Params.GroupId)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	results := make(model.GroupMemberBulkResults, 0, len(users))
+	for _, user := range users {
+		results = append(results, &model.GroupMemberBulkResult{Identifier: user.Email, UserId: user.Id, Status: model.GroupMemberBulkStatusNoop})
+	}
+
+	if r.Header.Get("Accept") == "text/csv" {
+		writeGroupMemberBulkResultsCSV(w, results)
+		return
+	}
+
+	w.Write([]byte(results.ToJson()))
 }
@@ -109,6 +109,40 @@ func BenchmarkUploadFile(b *testing.B) {
 
 			},
 		},
+		{
+			// ResumableUpload measures the tus-protocol path (createUploadSession
+			// + repeated UploadData PATCHes) against the same payloads the other
+			// cases use, in 1MB chunks, so the overhead of persisting the
+			// UploadSession's offset on every PATCH is visible next to the
+			// single-shot UploadFile case above.
+			title: "ResumableUpload",
+			f: func(b *testing.B, n int, data []byte, ext string) {
+				session, err := th.App.CreateUploadSession(channelId, userId, fmt.Sprintf("BenchmarkResumableUpload-%d%s", n, ext), int64(len(data)))
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				const chunkSize = 1024 * 1024
+				for offset := 0; offset < len(data); offset += chunkSize {
+					end := offset + chunkSize
+					if end > len(data) {
+						end = len(data)
+					}
+					session, err = th.App.UploadData(session, int64(offset), data[offset:end])
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				defer func() {
+					result := <-th.App.Srv.Store.FileInfo().Get(session.FileId)
+					if result.Err == nil {
+						th.App.RemoveFile(result.Data.(*model.FileInfo).Path)
+					}
+					<-th.App.Srv.Store.FileInfo().PermanentDelete(session.FileId)
+				}()
+			},
+		},
 	}
 
 	for _, fb := range file_benchmarks {
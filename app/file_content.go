@@ -0,0 +1,56 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// ResolveFileContent is the content-addressable storage hook UploadFile/
+// DoUploadFile (not present in this tree) are meant to call once an
+// upload's bytes have been fully buffered and its SHA-256 digest computed.
+//
+// If a FileContent row already exists for hash, the caller should skip
+// writing a new backend object entirely and point the new FileInfo's Path
+// (and, for an image, ThumbnailPath/PreviewPath) at the returned
+// FileContent's StoragePath -- ResolveFileContent has already incremented
+// its RefCount to account for the new reference. Otherwise the caller must
+// write the object to model.ContentAddressedPath(hash) itself and then call
+// FileContentCreate to register it with RefCount 1; ResolveFileContent
+// returns (nil, nil) in that case rather than doing the write itself, since
+// it has no access to the upload's bytes or the filesstore backend to use.
+//
+// Gating this behind FileSettings.EnableContentAddressableStorage is left
+// for whoever wires this in: the config package isn't present in this tree.
+func (a *App) ResolveFileContent(hash string, size int64, backend string) (*model.FileContent, *model.AppError) {
+	existing, err := a.Srv.Store.FileContent().FileContentGetByHash(context.Background(), hash)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, nil
+	}
+
+	if existing.Size != size || existing.Backend != backend {
+		return nil, model.NewAppError("ResolveFileContent", "app.file_content.resolve.mismatch.app_error", nil, "hash="+hash, http.StatusInternalServerError)
+	}
+
+	if _, err := a.Srv.Store.FileContent().FileContentIncrementRefCount(context.Background(), hash); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// ReleaseFileContent records that a FileInfo referencing hash was deleted.
+// It returns true when that was the last reference, telling the caller
+// (the absent FileInfo deletion path) that it's now safe to unlink
+// model.ContentAddressedPath(hash)/model.ContentAddressedThumbnailPath(hash)
+// from the filesstore backend.
+func (a *App) ReleaseFileContent(hash string) (bool, *model.AppError) {
+	return a.Srv.Store.FileContent().FileContentDecrementRefCount(context.Background(), hash)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/mlog"
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/services/filescan"
+)
+
+// fileScanner is the Scanner EnqueueFileScan submits uploads to. Ordinarily
+// this would be built once at startup from FileSettings.ScanEngine/
+// ScanEndpoint via filescan.NewScanner, but the config package and app
+// startup wiring aren't present in this tree, so it's exposed as a
+// package-level setter instead of an App field; SetFileScanner(nil)
+// disables scanning, which is also the default.
+var fileScanner filescan.Scanner
+
+// blockOnInfected mirrors FileSettings.BlockOnInfected: when true (the
+// default), CheckFileScanGate treats a scan that errored the same as one
+// that found malware, rather than letting an unscanned file through.
+var blockOnInfected = true
+
+// SetFileScanner installs the Scanner EnqueueFileScan submits uploads to.
+// Tests call this directly to stub a scanner; real wiring belongs in the
+// startup code that also isn't present in this tree.
+func SetFileScanner(scanner filescan.Scanner) {
+	fileScanner = scanner
+}
+
+// SetBlockOnInfected mirrors FileSettings.BlockOnInfected.
+func SetBlockOnInfected(block bool) {
+	blockOnInfected = block
+}
+
+const fileScanWorkerCount = 4
+
+var (
+	fileScanJobs        = make(chan fileScanJob, 256)
+	fileScanWorkersOnce sync.Once
+)
+
+type fileScanJob struct {
+	app    *App
+	fileId string
+	name   string
+	data   []byte
+}
+
+// EnqueueFileScan records a pending verdict for fileId and hands its bytes
+// to the worker pool for scanning. Called once UploadFile (not present in
+// this tree) or finalizeUploadSession has persisted a FileInfo, but before
+// it's readable: GetFile*/GetPublicFile consult CheckFileScanGate and
+// reject a file still pending, so there's no window where an unscanned
+// file is retrievable.
+//
+// If no Scanner is configured, this is a no-op: CheckFileScanGate only
+// blocks on an actual FileScanStatus row, and none is ever written.
+func (a *App) EnqueueFileScan(fileId string, name string, data []byte) {
+	if fileScanner == nil {
+		return
+	}
+
+	if _, err := a.Srv.Store.FileScanStatus().FileScanStatusUpsert(context.Background(), &model.FileScanStatus{
+		FileId:   fileId,
+		Status:   model.FILE_SCAN_STATUS_PENDING,
+		UpdateAt: model.GetMillis(),
+	}); err != nil {
+		a.Log.Error("failed to record pending file scan status", mlog.String("file_id", fileId), mlog.Err(err))
+		return
+	}
+
+	fileScanWorkersOnce.Do(a.startFileScanWorkers)
+
+	fileScanJobs <- fileScanJob{app: a, fileId: fileId, name: name, data: data}
+}
+
+// startFileScanWorkers launches the fixed-size pool that drains
+// fileScanJobs, so a burst of uploads scans concurrently instead of
+// serially. It runs once for the process's lifetime, not once per App --
+// every App shares the same job queue and worker pool.
+func (a *App) startFileScanWorkers() {
+	for i := 0; i < fileScanWorkerCount; i++ {
+		go func() {
+			for job := range fileScanJobs {
+				job.app.runFileScan(job)
+			}
+		}()
+	}
+}
+
+// runFileScan is the body of a single worker pool iteration: it calls the
+// configured Scanner and persists the resulting verdict.
+func (a *App) runFileScan(job fileScanJob) {
+	verdict, err := fileScanner.Scan(bytes.NewReader(job.data), job.name)
+
+	status := &model.FileScanStatus{
+		FileId:   job.fileId,
+		UpdateAt: model.GetMillis(),
+	}
+	if err != nil {
+		status.Status = model.FILE_SCAN_STATUS_ERROR
+	} else {
+		switch verdict.Status {
+		case filescan.StatusInfected:
+			status.Status = model.FILE_SCAN_STATUS_INFECTED
+			status.SignatureName = verdict.SignatureName
+		case filescan.StatusClean:
+			status.Status = model.FILE_SCAN_STATUS_CLEAN
+		default:
+			status.Status = model.FILE_SCAN_STATUS_PENDING
+		}
+	}
+
+	if _, upsertErr := a.Srv.Store.FileScanStatus().FileScanStatusUpsert(context.Background(), status); upsertErr != nil {
+		a.Log.Error("failed to record file scan verdict", mlog.String("file_id", job.fileId), mlog.Err(upsertErr))
+	}
+
+	if status.Status == model.FILE_SCAN_STATUS_INFECTED {
+		a.notifyFileScanInfected(status)
+	}
+}
+
+// notifyFileScanInfected records an audit entry and notifies connected
+// clients (an admin console watching scan status, in particular) that a
+// background scan turned up malware in a file that was already uploaded
+// and potentially already shared.
+func (a *App) notifyFileScanInfected(status *model.FileScanStatus) {
+	audit := &model.Audit{Action: "file_scan_infected", ExtraInfo: "file_id=" + status.FileId + " signature=" + status.SignatureName}
+	if err := a.Srv.Store.Audit().Save(audit); err != nil {
+		a.Log.Error("Failed to save file scan audit record", mlog.String("file_id", status.FileId), mlog.Err(err))
+	}
+
+	message := model.NewWebSocketEvent(model.WEBSOCKET_EVENT_FILE_SCAN_INFECTED, "", "", "", nil)
+	message.Add("file_id", status.FileId)
+	message.Add("signature_name", status.SignatureName)
+	a.Publish(message)
+}
+
+// GetFileScanStatus returns the scan status recorded for fileId, or
+// FILE_SCAN_STATUS_CLEAN if no row exists -- either scanning is disabled,
+// or the file predates this feature, and in both cases it should be
+// retrievable exactly as it always was.
+func (a *App) GetFileScanStatus(fileId string) (*model.FileScanStatus, *model.AppError) {
+	status, err := a.Srv.Store.FileScanStatus().FileScanStatusGet(context.Background(), fileId)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return &model.FileScanStatus{FileId: fileId, Status: model.FILE_SCAN_STATUS_CLEAN}, nil
+	}
+	return status, nil
+}
+
+// CheckFileScanGate is the gate GetFile/GetFileThumbnail/GetFilePreview/
+// GetPublicFile all run before serving a file's bytes: it returns
+// 423/Locked while a scan is still pending, and 451 once a file is known
+// (or, with BlockOnInfected, merely failed) to be infected -- unless the
+// requester is a system admin, who can always retrieve the file to
+// investigate or manage the false positive.
+func (a *App) CheckFileScanGate(fileId string, isSystemAdmin bool) *model.AppError {
+	if isSystemAdmin {
+		return nil
+	}
+
+	status, err := a.GetFileScanStatus(fileId)
+	if err != nil {
+		return err
+	}
+
+	switch status.Status {
+	case model.FILE_SCAN_STATUS_PENDING:
+		return model.NewAppError("CheckFileScanGate", "app.file_scan.gate.pending.app_error", nil, "file_id="+fileId, http.StatusLocked)
+	case model.FILE_SCAN_STATUS_INFECTED:
+		return model.NewAppError("CheckFileScanGate", "app.file_scan.gate.infected.app_error", nil, "file_id="+fileId, http.StatusUnavailableForLegalReasons)
+	case model.FILE_SCAN_STATUS_ERROR:
+		if blockOnInfected {
+			return model.NewAppError("CheckFileScanGate", "app.file_scan.gate.infected.app_error", nil, "file_id="+fileId, http.StatusUnavailableForLegalReasons)
+		}
+	}
+
+	return nil
+}
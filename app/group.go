@@ -0,0 +1,171 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/mlog"
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// MaxGroupMemberBulkBatchSize bounds how many add+remove identifiers
+// BulkUpsertGroupMembers will process in a single call, the same way
+// groupSyncReconcilePageSize bounds a single SyncSyncableGroupsPage call: a
+// very large LDAP-mapped group still imports, just across several requests
+// instead of one that ties up a connection indefinitely.
+//
+// This belongs on config (e.g. ServiceSettings.GroupMembershipBulkMaxBatchSize)
+// once this tree has a config package again; until then it's a plain
+// constant, the same workaround app/file_scan.go already uses for
+// cross-cutting settings that would otherwise live there.
+const MaxGroupMemberBulkBatchSize = 1000
+
+// GetGroupMemberUsers returns every non-deleted member of groupId as a full
+// User record, for the GET /groups/{group_id}/members/export endpoint.
+func (a *App) GetGroupMemberUsers(groupId string) ([]*model.User, *model.AppError) {
+	return a.Srv.Store.Group().GetMemberUsers(context.Background(), groupId)
+}
+
+// SearchGroups filters and sorts the group list for an admin UI (e.g. a
+// "pick a group to sync here" picker that should only show groups not
+// already linked to the team/channel being configured), pushing the work
+// into a single indexed store query instead of paging through every group.
+func (a *App) SearchGroups(opts model.GroupSearchOpts) (*model.GroupSearchResult, *model.AppError) {
+	return a.Srv.Store.Group().SearchGroups(context.Background(), opts)
+}
+
+// LogGroupAudit records a group-management audit entry through the existing
+// audit store, so compliance exports that already cover user/team changes
+// also cover group create/update/delete, member add/remove, and syncable
+// changes. action should be one of create/update/delete/member_add/
+// member_remove/syncable_change; extraInfo carries the identifying/diff
+// detail (e.g. "name=foo display_name=Foo" on create, or a list of changed
+// fields on update).
+//
+// A failure to persist the audit record is logged but never surfaces to the
+// caller -- same as every other fire-and-forget notification in this
+// package (see sendGroupSyncableWebsocketEvent) -- since the group
+// operation itself already succeeded by the time this runs.
+func (a *App) LogGroupAudit(userId string, groupId string, action string, extraInfo string) {
+	audit := &model.Audit{UserId: userId, Action: "group_" + action, ExtraInfo: "group_id=" + groupId + " " + extraInfo}
+	if err := a.Srv.Store.Audit().Save(audit); err != nil {
+		a.Log.Error("Failed to save group audit record", mlog.String("group_id", groupId), mlog.String("action", action), mlog.Err(err))
+	}
+}
+
+// resolveGroupMemberIdentifiers resolves every identifier in identifiers to
+// a Mattermost user id. Each identifier is, in order of preference: a raw
+// user id, an email address (if it contains "@"), or otherwise an LDAP
+// distinguished name -- whichever form is most convenient for whatever
+// produced the import list, e.g. an LDAP group export.
+//
+// Raw ids resolve for free; every email identifier is resolved by a single
+// GetByEmails call and every LDAP identifier by a single GetByAuths call,
+// instead of one query per identifier. It returns the resolved ids keyed by
+// their original identifier, plus an error result for any identifier that
+// didn't resolve to a user.
+func (a *App) resolveGroupMemberIdentifiers(identifiers []string) (map[string]string, model.GroupMemberBulkResults) {
+	ids := make(map[string]string, len(identifiers))
+	var errs model.GroupMemberBulkResults
+
+	var emails []string
+	var dns []string
+	for _, identifier := range identifiers {
+		switch {
+		case model.IsValidId(identifier):
+			ids[identifier] = identifier
+		case strings.Contains(identifier, "@"):
+			emails = append(emails, identifier)
+		default:
+			dns = append(dns, identifier)
+		}
+	}
+
+	if len(emails) > 0 {
+		users, err := a.Srv.Store.User().GetByEmails(emails)
+		if err != nil {
+			for _, identifier := range emails {
+				errs = append(errs, &model.GroupMemberBulkResult{Identifier: identifier, Status: model.GroupMemberBulkStatusError, Error: err})
+			}
+		} else {
+			byEmail := make(map[string]*model.User, len(users))
+			for _, user := range users {
+				byEmail[user.Email] = user
+			}
+			for _, identifier := range emails {
+				if user, ok := byEmail[identifier]; ok {
+					ids[identifier] = user.Id
+				} else {
+					errs = append(errs, &model.GroupMemberBulkResult{Identifier: identifier, Status: model.GroupMemberBulkStatusError, Error: model.NewAppError("App.resolveGroupMemberIdentifiers", "app.group.resolve_group_member_identifiers.not_found", nil, "identifier="+identifier, http.StatusNotFound)})
+				}
+			}
+		}
+	}
+
+	if len(dns) > 0 {
+		users, err := a.Srv.Store.User().GetByAuths(dns, model.USER_AUTH_SERVICE_LDAP)
+		if err != nil {
+			for _, identifier := range dns {
+				errs = append(errs, &model.GroupMemberBulkResult{Identifier: identifier, Status: model.GroupMemberBulkStatusError, Error: err})
+			}
+		} else {
+			byAuth := make(map[string]*model.User, len(users))
+			for _, user := range users {
+				if user.AuthData != nil {
+					byAuth[*user.AuthData] = user
+				}
+			}
+			for _, identifier := range dns {
+				if user, ok := byAuth[identifier]; ok {
+					ids[identifier] = user.Id
+				} else {
+					errs = append(errs, &model.GroupMemberBulkResult{Identifier: identifier, Status: model.GroupMemberBulkStatusError, Error: model.NewAppError("App.resolveGroupMemberIdentifiers", "app.group.resolve_group_member_identifiers.not_found", nil, "identifier="+identifier, http.StatusNotFound)})
+				}
+			}
+		}
+	}
+
+	return ids, errs
+}
+
+// BulkUpsertGroupMembers adds and removes groupId's membership for a batch
+// of users in one pass: every identifier in add/remove is resolved to a
+// user id via resolveGroupMemberIdentifiers, which batches the lookup into
+// a single GetByEmails call and a single GetByAuths call per identifier
+// type instead of the N-query pattern a loop of single GetByEmail/GetByAuth
+// calls would incur, then the resolved ids are applied in a single
+// store-layer transaction, so a large LDAP-mapped group can be onboarded in
+// one request instead of scripting thousands of individual API calls.
+//
+// A resolution failure, or an already-a-member/already-not-a-member
+// conflict for a single identifier, is recorded on its own result row
+// rather than aborting the whole batch; only an unexpected store error
+// fails the call entirely.
+func (a *App) BulkUpsertGroupMembers(groupId string, add []string, remove []string) (model.GroupMemberBulkResults, *model.AppError) {
+	if len(add)+len(remove) > MaxGroupMemberBulkBatchSize {
+		return nil, model.NewAppError("App.BulkUpsertGroupMembers", "app.group.bulk_upsert_group_members.too_large", map[string]interface{}{"Max": MaxGroupMemberBulkBatchSize}, "", http.StatusBadRequest)
+	}
+
+	var results model.GroupMemberBulkResults
+
+	addIds, addErrs := a.resolveGroupMemberIdentifiers(add)
+	results = append(results, addErrs...)
+
+	removeIds, removeErrs := a.resolveGroupMemberIdentifiers(remove)
+	results = append(results, removeErrs...)
+
+	if len(addIds) == 0 && len(removeIds) == 0 {
+		return results, nil
+	}
+
+	rowResults, err := a.Srv.Store.Group().BulkUpsertMembers(context.Background(), groupId, addIds, removeIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(results, rowResults...), nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/mlog"
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// uploadSessionTeamId mirrors api4.FILE_TEAM_ID: uploaded files aren't
+// scoped to a team, only to a channel, but UploadFileContext still expects
+// one. Duplicated here rather than imported since api4 imports app, not the
+// other way around.
+const uploadSessionTeamId = "noteam"
+
+// CreateUploadSession starts a new resumable (tus 1.0) upload: it persists
+// an UploadSession row so the transfer can resume after a dropped
+// connection or a server restart, and returns the session with its
+// server-assigned Id for the client to address subsequent HEAD/PATCH calls
+// at.
+func (a *App) CreateUploadSession(channelId string, userId string, filename string, fileSize int64) (*model.UploadSession, *model.AppError) {
+	if !*a.Config().FileSettings.EnableFileAttachments {
+		return nil, model.NewAppError("CreateUploadSession", "api.file.attachments.disabled.app_error", nil, "", http.StatusNotImplemented)
+	}
+
+	if fileSize > *a.Config().FileSettings.MaxFileSize {
+		return nil, model.NewAppError("CreateUploadSession", "api.file.upload_file.too_large.app_error", nil, "", http.StatusRequestEntityTooLarge)
+	}
+
+	session := &model.UploadSession{
+		Id:        model.NewId(),
+		ChannelId: channelId,
+		UserId:    userId,
+		Filename:  filename,
+		FileSize:  fileSize,
+		CreateAt:  model.GetMillis(),
+		ExpireAt:  model.GetMillis() + model.UPLOAD_SESSION_EXPIRY_MS,
+	}
+
+	return a.Srv.Store.UploadSession().UploadSessionCreate(context.Background(), session)
+}
+
+// GetUploadSession returns the current state of a resumable upload, the
+// counterpart of a tus "HEAD" call.
+func (a *App) GetUploadSession(id string) (*model.UploadSession, *model.AppError) {
+	return a.Srv.Store.UploadSession().UploadSessionGet(context.Background(), id)
+}
+
+// UploadData appends data to a resumable upload at clientOffset, the
+// counterpart of a tus "PATCH" call, and returns the session with its
+// updated FileOffset. Once FileOffset reaches FileSize, the accumulated
+// bytes are run through UploadFile -- the same FileInfo/thumbnail/preview
+// pipeline a regular upload goes through -- and the session is deleted.
+//
+// The .part object is read back in full and rewritten on every call instead
+// of being appended to in place: the filesstore backend referenced
+// elsewhere in this tree only exposes whole-object ReadFile/WriteFile, not
+// an append or multipart-upload primitive, so this is O(n^2) in the number
+// of chunks for a given upload until the backend gains one.
+func (a *App) UploadData(session *model.UploadSession, clientOffset int64, data []byte) (*model.UploadSession, *model.AppError) {
+	if clientOffset != session.FileOffset {
+		return nil, model.NewAppError("UploadData", "api.file.upload_data.conflict.app_error", nil, "", http.StatusConflict)
+	}
+
+	existing, appErr := a.ReadFile(session.PartPath())
+	if appErr != nil && session.FileOffset != 0 {
+		return nil, appErr
+	}
+
+	combined := append(existing, data...)
+	if int64(len(combined)) > session.FileSize {
+		return nil, model.NewAppError("UploadData", "api.file.upload_data.too_large.app_error", nil, "", http.StatusRequestEntityTooLarge)
+	}
+
+	if _, appErr := a.WriteFile(bytes.NewReader(combined), session.PartPath()); appErr != nil {
+		return nil, appErr
+	}
+
+	session.FileOffset = int64(len(combined))
+
+	if _, appErr := a.Srv.Store.UploadSession().UploadSessionUpdateOffset(context.Background(), session.Id, session.FileOffset); appErr != nil {
+		return nil, appErr
+	}
+
+	if session.FileOffset < session.FileSize {
+		return session, nil
+	}
+
+	return session, a.finalizeUploadSession(session)
+}
+
+// CancelUploadSession aborts an in-progress resumable upload: it removes
+// the partial .part object written so far and deletes the UploadSession
+// row, the counterpart of a tus "DELETE" call. Unlike finalizeUploadSession,
+// this never invokes UploadFile -- the bytes received so far are simply
+// discarded.
+func (a *App) CancelUploadSession(session *model.UploadSession) *model.AppError {
+	if appErr := a.RemoveFile(session.PartPath()); appErr != nil {
+		return appErr
+	}
+
+	_, appErr := a.Srv.Store.UploadSession().UploadSessionDelete(context.Background(), session.Id)
+	return appErr
+}
+
+// PruneExpiredUploadSessions removes every UploadSession whose ExpireAt has
+// passed, along with its backing .part object, so an abandoned resumable
+// upload doesn't hold onto filestore space and a UploadSessions row
+// forever. It's meant to be called periodically by a janitor (e.g. a
+// scheduled job once this tree's jobs subsystem exists); a single sweep
+// logs and skips a session whose .part removal fails rather than aborting
+// the whole pass, so one bad session doesn't block cleanup of the rest.
+func (a *App) PruneExpiredUploadSessions() *model.AppError {
+	expired, appErr := a.Srv.Store.UploadSession().GetExpired(context.Background(), model.GetMillis())
+	if appErr != nil {
+		return appErr
+	}
+
+	for _, session := range expired {
+		if appErr := a.RemoveFile(session.PartPath()); appErr != nil {
+			a.Log.Error("Failed to remove expired upload session's part object", mlog.String("upload_id", session.Id), mlog.Err(appErr))
+			continue
+		}
+
+		if _, appErr := a.Srv.Store.UploadSession().UploadSessionDelete(context.Background(), session.Id); appErr != nil {
+			a.Log.Error("Failed to delete expired upload session", mlog.String("upload_id", session.Id), mlog.Err(appErr))
+		}
+	}
+
+	return nil
+}
+
+// finalizeUploadSession is called once an upload's FileOffset reaches its
+// FileSize: it runs the completed .part object through the regular
+// UploadFile pipeline and tears down the session.
+func (a *App) finalizeUploadSession(session *model.UploadSession) *model.AppError {
+	complete, appErr := a.ReadFile(session.PartPath())
+	if appErr != nil {
+		return appErr
+	}
+
+	fileInfo, appErr := a.UploadFile(&UploadFileContext{
+		Timestamp:     time.Now(),
+		TeamId:        uploadSessionTeamId,
+		ChannelId:     session.ChannelId,
+		UserId:        session.UserId,
+		Name:          session.Filename,
+		ContentLength: session.FileSize,
+		Input:         ioutil.NopCloser(bytes.NewReader(complete)),
+	})
+	if appErr != nil {
+		return appErr
+	}
+	session.FileId = fileInfo.Id
+
+	// Submit the completed upload for scanning before it's reachable: the
+	// FileInfo row already exists at this point, but CheckFileScanGate
+	// blocks every read endpoint on it until a verdict -- or no scanner at
+	// all -- clears it.
+	a.EnqueueFileScan(fileInfo.Id, session.Filename, complete)
+
+	if appErr := a.RemoveFile(session.PartPath()); appErr != nil {
+		return appErr
+	}
+
+	_, appErr = a.Srv.Store.UploadSession().UploadSessionDelete(context.Background(), session.Id)
+	return appErr
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// FileContent is a row of the content-addressable FileContent table: one
+// entry per distinct SHA-256 digest actually stored in the filesstore
+// backend, shared by every FileInfo.ContentHash that matches it. RefCount
+// tracks how many FileInfo rows currently point at it, so the backend
+// object can be safely unlinked once the last one is deleted.
+type FileContent struct {
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	Backend     string `json:"backend"`
+	StoragePath string `json:"storage_path"`
+	RefCount    int64  `json:"ref_count"`
+}
+
+func (fc *FileContent) IsValid() *AppError {
+	if len(fc.Hash) != 64 {
+		return NewAppError("FileContent.IsValid", "model.file_content.hash.app_error", nil, "", http.StatusBadRequest)
+	}
+	if fc.Size <= 0 {
+		return NewAppError("FileContent.IsValid", "model.file_content.size.app_error", nil, "", http.StatusBadRequest)
+	}
+	if fc.Backend == "" {
+		return NewAppError("FileContent.IsValid", "model.file_content.backend.app_error", nil, "", http.StatusBadRequest)
+	}
+	if fc.StoragePath == "" {
+		return NewAppError("FileContent.IsValid", "model.file_content.storage_path.app_error", nil, "", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// ContentAddressedPath is the filesstore path a file with the given
+// SHA-256 hex digest is stored under, sharded two levels deep so no single
+// directory ends up with one entry per distinct file ever uploaded.
+func ContentAddressedPath(hash string) string {
+	return fmt.Sprintf("sha256/%s/%s/%s", hash[0:2], hash[2:4], hash)
+}
+
+// ContentAddressedThumbnailPath is the companion thumbnail path for a
+// content-addressed file.
+func ContentAddressedThumbnailPath(hash string) string {
+	return fmt.Sprintf("sha256/%s/%s/%s_thumb.jpg", hash[0:2], hash[2:4], hash)
+}
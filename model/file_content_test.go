@@ -0,0 +1,43 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import "testing"
+
+func TestContentAddressedPath(t *testing.T) {
+	hash := "aabbccddeeff00112233445566778899aabbccddeeff00112233445566778899"[:64]
+
+	if got, want := ContentAddressedPath(hash), "sha256/aa/bb/"+hash; got != want {
+		t.Fatalf("ContentAddressedPath() = %q, want %q", got, want)
+	}
+
+	if got, want := ContentAddressedThumbnailPath(hash), "sha256/aa/bb/"+hash+"_thumb.jpg"; got != want {
+		t.Fatalf("ContentAddressedThumbnailPath() = %q, want %q", got, want)
+	}
+}
+
+func TestFileContentIsValid(t *testing.T) {
+	hash := "aabbccddeeff00112233445566778899aabbccddeeff00112233445566778899"[:64]
+
+	valid := &FileContent{Hash: hash, Size: 1024, Backend: "local", StoragePath: ContentAddressedPath(hash)}
+	if err := valid.IsValid(); err != nil {
+		t.Fatalf("expected a valid FileContent to pass validation, got %v", err)
+	}
+
+	cases := []struct {
+		name string
+		fc   *FileContent
+	}{
+		{"short hash", &FileContent{Hash: hash[:10], Size: 1024, Backend: "local", StoragePath: ContentAddressedPath(hash)}},
+		{"zero size", &FileContent{Hash: hash, Size: 0, Backend: "local", StoragePath: ContentAddressedPath(hash)}},
+		{"empty backend", &FileContent{Hash: hash, Size: 1024, Backend: "", StoragePath: ContentAddressedPath(hash)}},
+		{"empty storage path", &FileContent{Hash: hash, Size: 1024, Backend: "local", StoragePath: ""}},
+	}
+
+	for _, c := range cases {
+		if err := c.fc.IsValid(); err == nil {
+			t.Errorf("%s: expected IsValid to return an error", c.name)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+const (
+	GroupNameMaxLength        = 64
+	GroupDisplayNameMaxLength = 128
+	GroupDescriptionMaxLength = 1024
+	GroupTypeMaxLength        = 64
+	GroupRemoteIdMaxLength    = 48
+	GroupSourceMaxLength      = 64
+)
+
+// GroupSource classifies where a Group's membership is authoritatively
+// managed, as distinct from the freeform Type field.
+type GroupSource string
+
+const (
+	GroupSourceCustom GroupSource = "custom"
+	GroupSourceLdap   GroupSource = "ldap"
+	GroupSourceSaml   GroupSource = "saml"
+)
+
+var groupSources = map[GroupSource]bool{
+	GroupSourceCustom: true,
+	GroupSourceLdap:   true,
+	GroupSourceSaml:   true,
+}
+
+type Group struct {
+	Id          string      `json:"id"`
+	Name        string      `json:"name"`
+	DisplayName string      `json:"display_name"`
+	Description string      `json:"description"`
+	Type        string      `json:"type"`
+	Source      GroupSource `json:"source"`
+	RemoteId    string      `json:"remote_id"`
+	CreateAt    int64       `json:"create_at"`
+	UpdateAt    int64       `json:"update_at"`
+	DeleteAt    int64       `json:"delete_at"`
+}
+
+type GroupMember struct {
+	GroupId  string `json:"group_id"`
+	UserId   string `json:"user_id"`
+	CreateAt int64  `json:"create_at"`
+	DeleteAt int64  `json:"delete_at"`
+}
+
+// UserTeamIDPair is a (UserId, TeamId) tuple identifying a pending
+// group-driven team membership addition.
+type UserTeamIDPair struct {
+	UserId string `db:"UserId"`
+	TeamId string `db:"TeamId"`
+}
+
+// UserChannelIDPair is a (UserId, ChannelId) tuple identifying a pending
+// group-driven channel membership addition.
+type UserChannelIDPair struct {
+	UserId    string `db:"UserId"`
+	ChannelId string `db:"ChannelId"`
+}
+
+// GroupSyncOp records a single TeamMembers/ChannelMembers insert or delete
+// applied by a GroupSyncAll reconciliation pass, so operators can audit
+// exactly what a given run changed.
+type GroupSyncOp struct {
+	UserId     string `json:"user_id"`
+	SyncableId string `json:"syncable_id"`
+	GroupId    string `json:"group_id"`
+}
+
+// GroupSyncResult reports every membership change a GroupSyncAll pass
+// applied, split by target type and direction.
+type GroupSyncResult struct {
+	TeamAdds       []GroupSyncOp `json:"team_adds"`
+	TeamRemoves    []GroupSyncOp `json:"team_removes"`
+	ChannelAdds    []GroupSyncOp `json:"channel_adds"`
+	ChannelRemoves []GroupSyncOp `json:"channel_removes"`
+}
+
+// GroupSyncJobStats summarizes a single bounded-page run of a group-sync job
+// against one syncable, e.g. app.SyncSyncableGroupsPage. LastGroupMembersCreateAt
+// is the highest GroupMembers.CreateAt the run observed; callers persist it
+// and pass it back in as the next run's cursor so paging resumes from there
+// instead of wall-clock time, which is unsafe under clock skew.
+type GroupSyncJobStats struct {
+	AddedMembers             int   `json:"added_members"`
+	RemovedMembers           int   `json:"removed_members"`
+	Errors                   int   `json:"errors"`
+	LastGroupMembersCreateAt int64 `json:"last_group_members_create_at"`
+}
+
+// GroupSyncPreview reports the membership changes a GroupSyncable's
+// reconciliation would make without actually applying them, for the
+// ?preview=true dry-run path on the group syncable endpoints.
+type GroupSyncPreview struct {
+	AddUserIds    []string `json:"add_user_ids"`
+	RemoveUserIds []string `json:"remove_user_ids"`
+}
+
+func (p *GroupSyncPreview) ToJson() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// Status values for a single row of a GroupMemberBulkRequest's processing.
+const (
+	GroupMemberBulkStatusAdded   = "added"
+	GroupMemberBulkStatusRemoved = "removed"
+	GroupMemberBulkStatusNoop    = "unchanged"
+	GroupMemberBulkStatusError   = "error"
+)
+
+// GroupMemberBulkRequest is the POST /groups/{group_id}/members/bulk body.
+// Each identifier may be a Mattermost user id, a user's email address, or
+// (for LDAP-sourced groups) the member's LDAP distinguished name -- whichever
+// is most convenient for whatever produced the list, e.g. an LDAP group
+// export.
+type GroupMemberBulkRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+func GroupMemberBulkRequestFromJson(data io.Reader) *GroupMemberBulkRequest {
+	var req GroupMemberBulkRequest
+	if err := json.NewDecoder(data).Decode(&req); err != nil {
+		return nil
+	}
+	return &req
+}
+
+// GroupMemberBulkResult reports what happened for one identifier in a
+// GroupMemberBulkRequest. Keeping a result row per identifier, rather than
+// failing the request on the first bad one, means a single typo'd email in
+// an otherwise-valid batch of a thousand doesn't force the caller to retry
+// the whole thing.
+type GroupMemberBulkResult struct {
+	Identifier string    `json:"identifier"`
+	UserId     string    `json:"user_id,omitempty"`
+	Status     string    `json:"status"`
+	Error      *AppError `json:"error,omitempty"`
+}
+
+// GroupMemberBulkResults is the response body for both
+// POST /groups/{group_id}/members/bulk (what was done) and
+// GET /groups/{group_id}/members/export (the current membership list, with
+// every Status left as GroupMemberBulkStatusNoop since export doesn't change
+// anything).
+type GroupMemberBulkResults []*GroupMemberBulkResult
+
+func (r GroupMemberBulkResults) ToJson() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// GroupSearchSortBy enumerates the columns GetGroupsPage/SearchGroups may
+// order results by.
+type GroupSearchSortBy string
+
+const (
+	GroupSearchSortByDisplayName GroupSearchSortBy = "display_name"
+	GroupSearchSortByMemberCount GroupSearchSortBy = "member_count"
+)
+
+// GroupSearchOpts narrows and orders a group listing for an admin UI: Term
+// prefix-matches Name/DisplayName, Source restricts to a single
+// GroupSource, and NotAssociatedToTeamId/NotAssociatedToChannelId exclude
+// groups already synced to the given team/channel, so a "pick a group to
+// sync here" picker only offers groups that aren't already linked.
+type GroupSearchOpts struct {
+	Term                     string
+	Source                   GroupSource
+	NotAssociatedToTeamId    string
+	NotAssociatedToChannelId string
+	SortBy                   GroupSearchSortBy
+	Page                     int
+	PerPage                  int
+}
+
+// GroupSearchResult is the return value of store.Group().SearchGroups: the
+// page of matching groups plus the total number of groups the search
+// matched (before paging), so a caller can populate an X-Total-Count header
+// without a second query.
+type GroupSearchResult struct {
+	Groups     []*Group
+	TotalCount int64
+}
+
+func (group *Group) IsValidForCreate() *AppError {
+	if err := group.IsValidForUpdate(); err != nil {
+		return err
+	}
+	if len(group.Id) != 0 {
+		return NewAppError("Group.IsValidForCreate", "model.group.id.app_error", nil, "", http.StatusBadRequest)
+	}
+	return nil
+}
+
+func (group *Group) IsValidForUpdate() *AppError {
+	if len(group.Name) == 0 || len(group.Name) > GroupNameMaxLength {
+		return NewAppError("Group.IsValidForUpdate", "model.group.name.app_error", nil, "", http.StatusBadRequest)
+	}
+	if len(group.DisplayName) == 0 || len(group.DisplayName) > GroupDisplayNameMaxLength {
+		return NewAppError("Group.IsValidForUpdate", "model.group.display_name.app_error", nil, "", http.StatusBadRequest)
+	}
+	if len(group.Description) > GroupDescriptionMaxLength {
+		return NewAppError("Group.IsValidForUpdate", "model.group.description.app_error", nil, "", http.StatusBadRequest)
+	}
+	if len(group.Type) > GroupTypeMaxLength {
+		return NewAppError("Group.IsValidForUpdate", "model.group.type.app_error", nil, "", http.StatusBadRequest)
+	}
+	if !groupSources[group.Source] {
+		return NewAppError("Group.IsValidForUpdate", "model.group.source.app_error", nil, "", http.StatusBadRequest)
+	}
+	if len(group.RemoteId) > GroupRemoteIdMaxLength {
+		return NewAppError("Group.IsValidForUpdate", "model.group.remote_id.app_error", nil, "", http.StatusBadRequest)
+	}
+	return nil
+}
+
+func (group *Group) ToJson() string {
+	b, err := json.Marshal(group)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func GroupFromJson(data io.Reader) *Group {
+	var group Group
+	if err := json.NewDecoder(data).Decode(&group); err != nil {
+		return nil
+	}
+	return &group
+}
+
+func (member *GroupMember) IsValid() *AppError {
+	if !IsValidId(member.GroupId) {
+		return NewAppError("GroupMember.IsValid", "model.group_member.group_id.app_error", nil, "", http.StatusBadRequest)
+	}
+	if !IsValidId(member.UserId) {
+		return NewAppError("GroupMember.IsValid", "model.group_member.user_id.app_error", nil, "", http.StatusBadRequest)
+	}
+	return nil
+}
@@ -4,7 +4,10 @@
 package model
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 )
 
 type GroupSyncableType int
@@ -12,21 +15,61 @@ type GroupSyncableType int
 const (
 	GSTeam GroupSyncableType = iota
 	GSChannel
+	GSSidebarCategory
 )
 
 func (gst GroupSyncableType) String() string {
-	return [...]string{"Team", "Channel"}[gst]
+	return [...]string{"Team", "Channel", "SidebarCategory"}[gst]
+}
+
+// TeamRoleIDs and ChannelRoleIDs enumerate the scheme role tokens that may
+// appear, space-separated, in GroupSyncable.SchemeRoles depending on the
+// syncable's Type. They mirror the role names used on TeamMember/ChannelMember.
+const (
+	TEAM_USER_ROLE_ID     = "team_user"
+	TEAM_ADMIN_ROLE_ID    = "team_admin"
+	CHANNEL_USER_ROLE_ID  = "channel_user"
+	CHANNEL_ADMIN_ROLE_ID = "channel_admin"
+)
+
+var teamRoleIDs = map[string]bool{
+	TEAM_USER_ROLE_ID:  true,
+	TEAM_ADMIN_ROLE_ID: true,
+}
+
+var channelRoleIDs = map[string]bool{
+	CHANNEL_USER_ROLE_ID:  true,
+	CHANNEL_ADMIN_ROLE_ID: true,
 }
 
 type GroupSyncable struct {
-	GroupId    string            `json:"group_id"`
-	SyncableId string            `db:"-" json:"syncable_id"`
-	CanLeave   bool              `json:"can_leave"`
-	AutoAdd    bool              `json:"auto_add"`
-	CreateAt   int64             `json:"create_at"`
-	DeleteAt   int64             `json:"delete_at"`
-	UpdateAt   int64             `json:"update_at"`
-	Type       GroupSyncableType `db:"-" json:"type"`
+	GroupId    string `json:"group_id"`
+	SyncableId string `db:"-" json:"syncable_id"`
+	// ParentId scopes SyncableId when Type is GSSidebarCategory: it is the
+	// id of the team the named sidebar category belongs to. Unused for
+	// GSTeam/GSChannel syncables.
+	ParentId    string            `db:"-" json:"parent_id"`
+	CanLeave    bool              `json:"can_leave"`
+	AutoAdd     bool              `json:"auto_add"`
+	SchemeRoles string            `json:"scheme_roles"`
+	// NextSyncAt is the millisecond timestamp at or after which the job
+	// runner may next run an auto-add pass for this syncable. Zero means
+	// due immediately.
+	NextSyncAt int64 `json:"next_sync_at"`
+	// SyncIntervalSeconds controls how far NextSyncAt is advanced after each
+	// sync pass. Zero preserves the legacy behavior of syncing on every job
+	// tick.
+	SyncIntervalSeconds int64 `json:"sync_interval_seconds"`
+	// SyncWindowStartMinutes and SyncWindowEndMinutes restrict syncing to a
+	// window of minutes-of-day (0-1440), letting admins stagger expensive
+	// LDAP-backed passes outside business hours. Equal values, including the
+	// zero value, mean no restriction.
+	SyncWindowStartMinutes int               `json:"sync_window_start_minutes"`
+	SyncWindowEndMinutes   int               `json:"sync_window_end_minutes"`
+	CreateAt               int64             `json:"create_at"`
+	DeleteAt               int64             `json:"delete_at"`
+	UpdateAt               int64             `json:"update_at"`
+	Type                   GroupSyncableType `db:"-" json:"type"`
 }
 
 func (syncable *GroupSyncable) IsValid() *AppError {
@@ -36,8 +79,106 @@ func (syncable *GroupSyncable) IsValid() *AppError {
 	if !IsValidId(syncable.SyncableId) {
 		return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.syncable_id.app_error", nil, "", http.StatusBadRequest)
 	}
+	if syncable.Type == GSSidebarCategory {
+		if !IsValidId(syncable.ParentId) {
+			return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.parent_id.app_error", nil, "", http.StatusBadRequest)
+		}
+	} else if syncable.ParentId != "" {
+		return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.parent_id.app_error", nil, "", http.StatusBadRequest)
+	}
 	if syncable.AutoAdd == false && syncable.CanLeave == false {
 		return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.invalid_state", nil, "", http.StatusBadRequest)
 	}
+	if syncable.SyncIntervalSeconds < 0 {
+		return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.sync_interval_seconds.app_error", nil, "", http.StatusBadRequest)
+	}
+	if syncable.SyncWindowStartMinutes < 0 || syncable.SyncWindowStartMinutes > 1440 {
+		return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.sync_window.app_error", nil, "", http.StatusBadRequest)
+	}
+	if syncable.SyncWindowEndMinutes < 0 || syncable.SyncWindowEndMinutes > 1440 {
+		return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.sync_window.app_error", nil, "", http.StatusBadRequest)
+	}
+	if err := syncable.isSchemeRolesValid(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// InSyncWindow reports whether minuteOfDay (0-1440) falls within the
+// syncable's configured sync window, so the job runner can skip syncables
+// that are scheduled for a later part of the day. A window where Start ==
+// End, including the zero value, means no restriction.
+func (syncable *GroupSyncable) InSyncWindow(minuteOfDay int) bool {
+	if syncable.SyncWindowStartMinutes == syncable.SyncWindowEndMinutes {
+		return true
+	}
+	if syncable.SyncWindowStartMinutes < syncable.SyncWindowEndMinutes {
+		return minuteOfDay >= syncable.SyncWindowStartMinutes && minuteOfDay < syncable.SyncWindowEndMinutes
+	}
+	// The window wraps past midnight, e.g. Start=1380 (11pm) End=120 (2am).
+	return minuteOfDay >= syncable.SyncWindowStartMinutes || minuteOfDay < syncable.SyncWindowEndMinutes
+}
+
+// isSchemeRolesValid ensures every token in SchemeRoles is a role that
+// actually applies to this syncable's target (team roles for GSTeam,
+// channel roles for GSChannel).
+func (syncable *GroupSyncable) isSchemeRolesValid() *AppError {
+	if syncable.SchemeRoles == "" {
+		return nil
+	}
+
+	var allowed map[string]bool
+	switch syncable.Type {
+	case GSTeam:
+		allowed = teamRoleIDs
+	case GSChannel:
+		allowed = channelRoleIDs
+	default:
+		return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.scheme_roles.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	for _, role := range strings.Fields(syncable.SchemeRoles) {
+		if !allowed[role] {
+			return NewAppError("GroupSyncable.SyncableIsValid", "model.group_syncable.scheme_roles.app_error", nil, "role="+role, http.StatusBadRequest)
+		}
+	}
+
 	return nil
 }
+
+func (syncable *GroupSyncable) ToJson() string {
+	b, err := json.Marshal(syncable)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func GroupSyncableFromJson(data io.Reader) *GroupSyncable {
+	var syncable GroupSyncable
+	if err := json.NewDecoder(data).Decode(&syncable); err != nil {
+		return nil
+	}
+	return &syncable
+}
+
+// GroupSyncableList is a thin wrapper around a slice of *GroupSyncable so callers
+// (e.g. websocket broadcasts, the REST layer) get JSON (de)serialization without
+// having to hand-roll it at each call site.
+type GroupSyncableList []*GroupSyncable
+
+func (l *GroupSyncableList) ToJson() string {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func GroupSyncableListFromJson(data io.Reader) GroupSyncableList {
+	var list GroupSyncableList
+	if err := json.NewDecoder(data).Decode(&list); err != nil {
+		return nil
+	}
+	return list
+}
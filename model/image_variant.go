@@ -0,0 +1,27 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import "fmt"
+
+// ImageVariantOptions is the w/h/fit/format/q request shape
+// Client.GetFilePreviewWithOptions/GetFileThumbnailWithOptions (defined in
+// model/client4.go, not present in this tree) send as query params against
+// GetFilePreview/GetFileThumbnail.
+type ImageVariantOptions struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// ImageVariantPath is the deterministic filesstore path a resized/
+// re-encoded preview or thumbnail variant is cached under. GetFilePreview/
+// GetFileThumbnail check this path before calling imagetransform.Transform,
+// so repeated requests for the same (fileId, w, h, fit, format, quality)
+// combination are served straight from the backend in O(1).
+func ImageVariantPath(fileId string, width, height int, fit, format string, quality int) string {
+	return fmt.Sprintf("image_variants/%s/%dx%d_%s_%s_q%d", fileId, width, height, fit, format, quality)
+}
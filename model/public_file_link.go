@@ -0,0 +1,75 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PublicFileLink is a row of the PublicFileLink table: one entry per
+// time-bounded link GeneratePublicLinkWithExpiry mints, recording who
+// created it and, optionally, how many downloads it's good for. Unlike
+// PublicLinkRevocation -- which only remembers that a (FileId, Nonce) pair
+// was revoked -- this is the link's full metadata, so an admin can list and
+// revoke every outstanding link for a file or for a user without already
+// knowing its nonce.
+type PublicFileLink struct {
+	Id            string `json:"id"`
+	FileId        string `json:"file_id"`
+	CreatorId     string `json:"creator_id"`
+	Nonce         string `json:"nonce"`
+	CreateAt      int64  `json:"create_at"`
+	ExpireAt      int64  `json:"expire_at"`
+	// MaxDownloads caps how many times GetPublicFile will serve this link
+	// before treating it as revoked; 0 means unlimited.
+	MaxDownloads  int64 `json:"max_downloads"`
+	DownloadCount int64 `json:"download_count"`
+	// RestrictedToUserId, when set, is the only session user GetPublicFile
+	// will serve this link to -- it's signed into the link's hash the same
+	// way Nonce is, so a link minted with a restriction can't be relaxed by
+	// simply dropping the uid query param. Empty means anyone holding the
+	// link can use it, same as before this field existed.
+	RestrictedToUserId string `json:"restricted_to_user_id"`
+}
+
+func (link *PublicFileLink) IsValid() *AppError {
+	if !IsValidId(link.Id) {
+		return NewAppError("PublicFileLink.IsValid", "model.public_file_link.id.app_error", nil, "", http.StatusBadRequest)
+	}
+	if !IsValidId(link.FileId) {
+		return NewAppError("PublicFileLink.IsValid", "model.public_file_link.file_id.app_error", nil, "id="+link.Id, http.StatusBadRequest)
+	}
+	if !IsValidId(link.CreatorId) {
+		return NewAppError("PublicFileLink.IsValid", "model.public_file_link.creator_id.app_error", nil, "id="+link.Id, http.StatusBadRequest)
+	}
+	if !IsValidId(link.Nonce) {
+		return NewAppError("PublicFileLink.IsValid", "model.public_file_link.nonce.app_error", nil, "id="+link.Id, http.StatusBadRequest)
+	}
+	if link.CreateAt == 0 {
+		return NewAppError("PublicFileLink.IsValid", "model.public_file_link.create_at.app_error", nil, "id="+link.Id, http.StatusBadRequest)
+	}
+	if link.MaxDownloads < 0 {
+		return NewAppError("PublicFileLink.IsValid", "model.public_file_link.max_downloads.app_error", nil, "id="+link.Id, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func (link *PublicFileLink) ToJson() string {
+	b, err := json.Marshal(link)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+type PublicFileLinkList []*PublicFileLink
+
+func (list PublicFileLinkList) ToJson() string {
+	b, err := json.Marshal(list)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
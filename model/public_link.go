@@ -0,0 +1,31 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import "net/http"
+
+// PublicLinkRevocation is a row of the PublicLinkRevocation table: one
+// entry per (FileId, Nonce) pair that GetPublicFile must reject even though
+// its signature is still valid and it hasn't expired yet. It exists so a
+// single link can be revoked -- App.RevokePublicLink -- without rotating
+// FileSettings.PublicLinkSalt, which invalidates every outstanding link for
+// every file at once.
+type PublicLinkRevocation struct {
+	FileId   string `json:"file_id"`
+	Nonce    string `json:"nonce"`
+	CreateAt int64  `json:"create_at"`
+}
+
+func (r *PublicLinkRevocation) IsValid() *AppError {
+	if !IsValidId(r.FileId) {
+		return NewAppError("PublicLinkRevocation.IsValid", "model.public_link_revocation.file_id.app_error", nil, "", http.StatusBadRequest)
+	}
+	if !IsValidId(r.Nonce) {
+		return NewAppError("PublicLinkRevocation.IsValid", "model.public_link_revocation.nonce.app_error", nil, "file_id="+r.FileId, http.StatusBadRequest)
+	}
+	if r.CreateAt == 0 {
+		return NewAppError("PublicLinkRevocation.IsValid", "model.public_link_revocation.create_at.app_error", nil, "file_id="+r.FileId, http.StatusBadRequest)
+	}
+	return nil
+}
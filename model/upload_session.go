@@ -0,0 +1,82 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// UPLOAD_SESSION_EXPIRY_MS is how long an UploadSession may sit idle before
+// it, and its backing .part object, become eligible for cleanup.
+const UPLOAD_SESSION_EXPIRY_MS = 24 * 60 * 60 * 1000
+
+// UploadSession tracks an in-progress resumable (tus 1.0 protocol) file
+// upload. A row persists for the lifetime of the upload so a server restart,
+// or a dropped connection on a flaky mobile network, doesn't lose progress:
+// the client resumes from FileOffset instead of re-sending the whole file.
+type UploadSession struct {
+	Id         string `json:"id"`
+	ChannelId  string `json:"channel_id"`
+	UserId     string `json:"user_id"`
+	Filename   string `json:"filename"`
+	FileSize   int64  `json:"file_size"`
+	FileOffset int64  `json:"file_offset"`
+	CreateAt   int64  `json:"create_at"`
+	// ExpireAt is the millisecond timestamp after which an incomplete
+	// session, and its backing .part object, may be garbage collected.
+	ExpireAt int64 `json:"expire_at"`
+	// FileId is set once FileOffset reaches FileSize and the completed
+	// upload has been run through the regular FileInfo pipeline. It's
+	// populated on the in-memory session UploadData returns to its caller;
+	// the underlying row is deleted in the same call, so it's never read
+	// back from the store.
+	FileId string `json:"file_id,omitempty"`
+}
+
+func (us *UploadSession) IsValid() *AppError {
+	if !IsValidId(us.Id) {
+		return NewAppError("UploadSession.IsValid", "model.upload_session.id.app_error", nil, "", http.StatusBadRequest)
+	}
+	if !IsValidId(us.ChannelId) {
+		return NewAppError("UploadSession.IsValid", "model.upload_session.channel_id.app_error", nil, "", http.StatusBadRequest)
+	}
+	if !IsValidId(us.UserId) {
+		return NewAppError("UploadSession.IsValid", "model.upload_session.user_id.app_error", nil, "", http.StatusBadRequest)
+	}
+	if us.Filename == "" {
+		return NewAppError("UploadSession.IsValid", "model.upload_session.filename.app_error", nil, "", http.StatusBadRequest)
+	}
+	if us.FileSize <= 0 {
+		return NewAppError("UploadSession.IsValid", "model.upload_session.file_size.app_error", nil, "", http.StatusBadRequest)
+	}
+	if us.FileOffset < 0 || us.FileOffset > us.FileSize {
+		return NewAppError("UploadSession.IsValid", "model.upload_session.file_offset.app_error", nil, "", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// PartPath is the filesstore-relative path of the object an in-progress
+// upload streams its bytes to. It's read back in full, run through
+// App.UploadFile, and removed once FileOffset reaches FileSize.
+func (us *UploadSession) PartPath() string {
+	return "uploads/" + us.Id + ".part"
+}
+
+func (us *UploadSession) ToJson() string {
+	b, err := json.Marshal(us)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func UploadSessionFromJson(data io.Reader) *UploadSession {
+	var us UploadSession
+	if err := json.NewDecoder(data).Decode(&us); err != nil {
+		return nil
+	}
+	return &us
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import "testing"
+
+func TestUploadSessionIsValid(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		session *UploadSession
+		valid   bool
+	}{
+		{
+			name: "valid",
+			session: &UploadSession{
+				Id:        NewId(),
+				ChannelId: NewId(),
+				UserId:    NewId(),
+				Filename:  "test.png",
+				FileSize:  1024,
+			},
+			valid: true,
+		},
+		{
+			name: "invalid id",
+			session: &UploadSession{
+				Id:        "not-an-id",
+				ChannelId: NewId(),
+				UserId:    NewId(),
+				Filename:  "test.png",
+				FileSize:  1024,
+			},
+		},
+		{
+			name: "missing filename",
+			session: &UploadSession{
+				Id:        NewId(),
+				ChannelId: NewId(),
+				UserId:    NewId(),
+				FileSize:  1024,
+			},
+		},
+		{
+			name: "non-positive file size",
+			session: &UploadSession{
+				Id:        NewId(),
+				ChannelId: NewId(),
+				UserId:    NewId(),
+				Filename:  "test.png",
+				FileSize:  0,
+			},
+		},
+		{
+			name: "offset past file size",
+			session: &UploadSession{
+				Id:         NewId(),
+				ChannelId:  NewId(),
+				UserId:     NewId(),
+				Filename:   "test.png",
+				FileSize:   1024,
+				FileOffset: 2048,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.session.IsValid()
+			if test.valid && err != nil {
+				t.Fatalf("expected valid, got %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestUploadSessionPartPath(t *testing.T) {
+	session := &UploadSession{Id: "abc123"}
+	if session.PartPath() != "uploads/abc123.part" {
+		t.Fatalf("unexpected part path: %s", session.PartPath())
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+// Websocket event types used to notify connected clients of server-side
+// changes they should reflect without polling. This file only carries the
+// events introduced alongside group syncables; the rest of the catalog lives
+// with the corresponding feature's server-side code.
+const (
+	WEBSOCKET_EVENT_GROUP_SYNCABLE_CREATED = "group_syncable_created"
+	WEBSOCKET_EVENT_GROUP_SYNCABLE_UPDATED = "group_syncable_updated"
+	WEBSOCKET_EVENT_GROUP_SYNCABLE_DELETED = "group_syncable_deleted"
+	// WEBSOCKET_EVENT_GROUP_MEMBER_ADD/REMOVE fire once per user as the
+	// group-sync reconciliation job adds or removes memberships, so clients
+	// watching a team/channel member list can update live instead of
+	// polling for the job to finish.
+	WEBSOCKET_EVENT_GROUP_MEMBER_ADD    = "group_member_add"
+	WEBSOCKET_EVENT_GROUP_MEMBER_REMOVE = "group_member_remove"
+	// WEBSOCKET_EVENT_FILE_SCAN_INFECTED fires when a background file scan
+	// (app.runFileScan) finds malware in an already-uploaded file, so an
+	// admin console watching scan status can flag it live instead of
+	// polling GetFileScanStatus.
+	WEBSOCKET_EVENT_FILE_SCAN_INFECTED = "file_scan_infected"
+)
@@ -0,0 +1,96 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package filescan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamAVChunkSize is the size of each length-prefixed chunk sent to clamd
+// over an INSTREAM session. clamd itself defaults to a 25MB StreamMaxLength,
+// so this is comfortably small.
+const clamAVChunkSize = 64 * 1024
+
+// ClamAVScanner scans files by speaking clamd's INSTREAM protocol over TCP:
+// https://linux.die.net/man/8/clamd -- send "zINSTREAM\0", then a sequence
+// of 4-byte big-endian length-prefixed chunks terminated by a zero-length
+// chunk, then read a single "stream: ..." reply.
+type ClamAVScanner struct {
+	address string
+	timeout time.Duration
+}
+
+func NewClamAVScanner(address string, timeout time.Duration) *ClamAVScanner {
+	return &ClamAVScanner{address: address, timeout: timeout}
+}
+
+func (s *ClamAVScanner) Scan(r io.Reader, name string) (Verdict, error) {
+	conn, err := net.DialTimeout("tcp", s.address, s.timeout)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("filescan: dial clamd at %s: %w", s.address, err)
+	}
+	defer conn.Close()
+
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Verdict{}, fmt.Errorf("filescan: send INSTREAM command for %s: %w", name, err)
+	}
+
+	chunk := make([]byte, clamAVChunkSize)
+	lenPrefix := make([]byte, 4)
+	for {
+		n, readErr := r.Read(chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(lenPrefix, uint32(n))
+			if _, err := conn.Write(lenPrefix); err != nil {
+				return Verdict{}, fmt.Errorf("filescan: write chunk length for %s: %w", name, err)
+			}
+			if _, err := conn.Write(chunk[:n]); err != nil {
+				return Verdict{}, fmt.Errorf("filescan: write chunk for %s: %w", name, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return Verdict{}, fmt.Errorf("filescan: read %s: %w", name, readErr)
+		}
+	}
+
+	// A zero-length chunk tells clamd the stream is complete.
+	binary.BigEndian.PutUint32(lenPrefix, 0)
+	if _, err := conn.Write(lenPrefix); err != nil {
+		return Verdict{}, fmt.Errorf("filescan: write end-of-stream marker for %s: %w", name, err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return Verdict{}, fmt.Errorf("filescan: read clamd reply for %s: %w", name, err)
+	}
+	reply = strings.TrimRight(reply, "\x00\r\n")
+
+	return parseClamAVReply(reply), nil
+}
+
+// parseClamAVReply turns a clamd INSTREAM reply into a Verdict. A clean
+// file replies "stream: OK"; an infected one replies
+// "stream: <signature name> FOUND".
+func parseClamAVReply(reply string) Verdict {
+	const foundSuffix = " FOUND"
+	if strings.HasSuffix(reply, foundSuffix) {
+		body := strings.TrimSuffix(reply, foundSuffix)
+		body = strings.TrimPrefix(body, "stream:")
+		return Verdict{Status: StatusInfected, SignatureName: strings.TrimSpace(body)}
+	}
+	return Verdict{Status: StatusClean}
+}
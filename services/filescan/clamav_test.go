@@ -0,0 +1,32 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package filescan
+
+import "testing"
+
+func TestParseClamAVReply(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		reply    string
+		expected Verdict
+	}{
+		{
+			name:     "clean",
+			reply:    "stream: OK",
+			expected: Verdict{Status: StatusClean},
+		},
+		{
+			name:     "infected",
+			reply:    "stream: Eicar-Test-Signature FOUND",
+			expected: Verdict{Status: StatusInfected, SignatureName: "Eicar-Test-Signature"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseClamAVReply(test.reply)
+			if got != test.expected {
+				t.Fatalf("parseClamAVReply(%q) = %+v, want %+v", test.reply, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package filescan provides pluggable antivirus/malware scanning of
+// uploaded files. app.UploadFiles (not present in this tree) is meant to
+// call a configured Scanner after an upload's bytes are buffered but
+// before its FileInfo is persisted, so an Infected verdict can be rejected
+// before the file is ever readable by other users.
+package filescan
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Status is the outcome of scanning a single file.
+type Status string
+
+const (
+	// StatusClean means the scanner read the whole file and found nothing.
+	StatusClean Status = "clean"
+	// StatusInfected means the scanner positively identified malware.
+	StatusInfected Status = "infected"
+	// StatusPending means the file has not been scanned yet, e.g. because
+	// the configured scanner was unreachable at upload time. Callers should
+	// persist this on FileInfo.ScanStatus and retry later via a rescan job.
+	StatusPending Status = "pending"
+)
+
+// Verdict is the result of a single Scan call.
+type Verdict struct {
+	Status Status
+	// SignatureName is the scanner-reported name of the malware found,
+	// populated only when Status is StatusInfected.
+	SignatureName string
+}
+
+// Scanner scans a single named file for malware. Implementations must
+// consume all of r before returning, since the caller may discard r
+// immediately afterwards.
+type Scanner interface {
+	Scan(r io.Reader, name string) (Verdict, error)
+}
+
+// Config configures which Scanner implementation to build and how to reach
+// it. It mirrors the FileSettings.AntivirusDriver/AntivirusAddress/
+// AntivirusTimeout config fields described in this package's originating
+// change request; model.Config itself isn't present in this tree to extend.
+type Config struct {
+	// Driver selects the Scanner implementation: "clamav", "icap", or ""
+	// (disabled).
+	Driver  string
+	Address string
+	Timeout time.Duration
+}
+
+// NewScanner builds the Scanner named by cfg.Driver. It returns a nil
+// Scanner and no error when cfg.Driver is empty, so callers can treat a nil
+// Scanner as "scanning disabled" without a separate feature flag check.
+func NewScanner(cfg Config) (Scanner, error) {
+	switch cfg.Driver {
+	case "":
+		return nil, nil
+	case "clamav":
+		return NewClamAVScanner(cfg.Address, cfg.Timeout), nil
+	case "icap":
+		return NewICAPScanner(cfg.Address, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("filescan: unknown driver %q", cfg.Driver)
+	}
+}
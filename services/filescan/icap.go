@@ -0,0 +1,128 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package filescan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ICAPScanner scans files via a generic ICAP (RFC 3507) RESPMOD exchange,
+// the protocol most non-ClamAV AV gateways (Symantec, Kaspersky, McAfee
+// Web Gateway, Sophos, c-icap+ClamAV) speak. The file is wrapped in a
+// synthetic HTTP response and submitted for inspection; the ICAP server's
+// reply tells us whether it passed the content through unmodified (clean)
+// or substituted a block page (infected).
+type ICAPScanner struct {
+	address string
+	timeout time.Duration
+}
+
+func NewICAPScanner(address string, timeout time.Duration) *ICAPScanner {
+	return &ICAPScanner{address: address, timeout: timeout}
+}
+
+func (s *ICAPScanner) Scan(r io.Reader, name string) (Verdict, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("filescan: read %s: %w", name, err)
+	}
+
+	conn, err := net.DialTimeout("tcp", s.address, s.timeout)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("filescan: dial icap server at %s: %w", s.address, err)
+	}
+	defer conn.Close()
+
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	if _, err := conn.Write(buildRespmodRequest(s.address, name, body)); err != nil {
+		return Verdict{}, fmt.Errorf("filescan: send RESPMOD request for %s: %w", name, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	statusLine, err := reader.ReadString('\n')
+	if err != nil {
+		return Verdict{}, fmt.Errorf("filescan: read icap status line for %s: %w", name, err)
+	}
+
+	headers, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return Verdict{}, fmt.Errorf("filescan: read icap headers for %s: %w", name, err)
+	}
+
+	return parseICAPStatus(statusLine, headers), nil
+}
+
+// buildRespmodRequest wraps the file as the body of a synthetic HTTP
+// response and encapsulates it in an ICAP RESPMOD request, per RFC 3507
+// section 4.5. The ICAP server inspects res-hdr+res-body as if they were a
+// real HTTP response the client was about to receive.
+func buildRespmodRequest(address string, name string, body []byte) []byte {
+	httpResponseHeader := fmt.Sprintf(
+		"HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", len(body))
+
+	var encapsulatedBody bytes.Buffer
+	fmt.Fprintf(&encapsulatedBody, "%x\r\n", len(body))
+	encapsulatedBody.Write(body)
+	encapsulatedBody.WriteString("\r\n0\r\n\r\n")
+
+	resHdrOffset := 0
+	resBodyOffset := len(httpResponseHeader)
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "RESPMOD icap://%s/respmod ICAP/1.0\r\n", address)
+	fmt.Fprintf(&req, "Host: %s\r\n", address)
+	req.WriteString("Allow: 204\r\n")
+	fmt.Fprintf(&req, "Encapsulated: res-hdr=%d, res-body=%d\r\n", resHdrOffset, resBodyOffset)
+	fmt.Fprintf(&req, "X-Filename: %s\r\n", name)
+	req.WriteString("\r\n")
+	req.WriteString(httpResponseHeader)
+	req.Write(encapsulatedBody.Bytes())
+
+	return req.Bytes()
+}
+
+// parseICAPStatus turns an ICAP status line (plus any headers the server
+// sent with it) into a Verdict. "204 No Content" is the ICAP way of saying
+// "no modifications needed" -- the content is clean. Any other 2xx means
+// the server is returning a modified response (typically a block page),
+// which we treat as infected, using X-Infection-Found/X-Virus-ID when the
+// server supplies one (the de facto convention used by c-icap+ClamAV and
+// similar gateways).
+func parseICAPStatus(statusLine string, headers map[string][]string) Verdict {
+	fields := strings.Fields(statusLine)
+	if len(fields) < 2 {
+		return Verdict{Status: StatusPending}
+	}
+
+	switch fields[1] {
+	case "204":
+		return Verdict{Status: StatusClean}
+	case "200":
+		signature := firstHeader(headers, "X-Infection-Found")
+		if signature == "" {
+			signature = firstHeader(headers, "X-Virus-Id")
+		}
+		return Verdict{Status: StatusInfected, SignatureName: signature}
+	default:
+		return Verdict{Status: StatusPending}
+	}
+}
+
+func firstHeader(headers map[string][]string, key string) string {
+	if values := headers[textproto.CanonicalMIMEHeaderKey(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package imagesanitize re-encodes JPEG/PNG images through Go's standard
+// image codecs to strip EXIF/XMP/IPTC metadata -- GPS coordinates, camera
+// serial numbers, embedded thumbnails -- that would otherwise round-trip
+// unchanged from an upload's original bytes to every later GetFile. app's
+// upload pipeline (not present in this tree) is meant to call StripMetadata
+// on the orientation-corrected image before it's written as the canonical
+// Path object, gated behind FileSettings.StripImageMetadata.
+//
+// Neither of Go's standard decoders preserve APPn/ancillary metadata
+// segments on re-encode, so a decode-then-encode round trip is sufficient:
+// it rewrites the file from pixel data alone. WebP isn't handled: the
+// standard library has no WebP encoder to re-encode through.
+package imagesanitize
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// JPEGQuality is the quality StripMetadata re-encodes JPEG images at. 90 is
+// visually lossless for chat attachments while still meaningfully smaller
+// than quality 100.
+const JPEGQuality = 90
+
+// SupportsFormat reports whether StripMetadata can sanitize the given
+// decoded image format name (as returned by image.Decode).
+func SupportsFormat(format string) bool {
+	return format == "jpeg" || format == "png"
+}
+
+// StripMetadata decodes data as format and re-encodes it with the same
+// codec, dropping every metadata segment the original carried. The
+// returned bytes are pixel-for-pixel equivalent to the input (re-encoding
+// a JPEG is lossy at JPEGQuality, so a small perceptual delta is expected;
+// PNG re-encoding is lossless).
+func StripMetadata(data []byte, format string) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("imagesanitize: decode: %w", err)
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+			return nil, fmt.Errorf("imagesanitize: encode jpeg: %w", err)
+		}
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("imagesanitize: encode png: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("imagesanitize: unsupported format %q", format)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// HasExifSegment reports whether a JPEG's byte stream still carries an
+// APP1 "Exif" segment -- the container every EXIF IFD, including the GPS
+// IFD, lives inside. StripMetadata's re-encoded output never has one,
+// since Go's jpeg encoder only ever writes image data, never APPn markers.
+func HasExifSegment(data []byte) bool {
+	// JPEG is a sequence of 0xFF-prefixed markers. SOI (0xFFD8) has no
+	// payload; every other marker we care about here is followed by a
+	// 2-byte big-endian length (including those 2 length bytes) and then
+	// its payload.
+	i := 0
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			i++
+			continue
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA { // Start of Scan: compressed image data follows, no more markers to scan.
+			break
+		}
+
+		if i+4 > len(data) {
+			break
+		}
+		segmentLen := int(data[i+2])<<8 | int(data[i+3])
+		if marker == 0xE1 && i+4+5 <= len(data) && bytes.HasPrefix(data[i+4:], []byte("Exif\x00")) {
+			return true
+		}
+
+		i += 2 + segmentLen
+	}
+
+	return false
+}
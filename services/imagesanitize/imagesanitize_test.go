@@ -0,0 +1,81 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package imagesanitize
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// withSyntheticExif splices a synthetic APP1 "Exif" segment -- standing in
+// for a real camera's GPS-tagged EXIF block -- right after a JPEG's SOI
+// marker. HasExifSegment only looks for the APP1/"Exif\x00" container, not
+// the TIFF IFD structure inside it, so the payload doesn't need to be a
+// valid TIFF/GPS IFD to exercise the detection and stripping paths.
+func withSyntheticExif(t *testing.T, jpegBytes []byte) []byte {
+	t.Helper()
+
+	if !bytes.HasPrefix(jpegBytes, []byte{0xFF, 0xD8}) {
+		t.Fatal("expected a JPEG SOI marker")
+	}
+
+	payload := append([]byte("Exif\x00\x00"), []byte("fake-tiff-header-with-a-gps-ifd-pointer")...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte((len(payload) + 2) & 0xFF)}
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpegBytes[:2]...)
+	out = append(out, segment...)
+	out = append(out, jpegBytes[2:]...)
+	return out
+}
+
+func TestStripMetadataRemovesExifSegment(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("encode fixture: %v", err)
+	}
+
+	tagged := withSyntheticExif(t, buf.Bytes())
+	if !HasExifSegment(tagged) {
+		t.Fatal("expected the synthetic fixture to carry an EXIF segment")
+	}
+
+	stripped, err := StripMetadata(tagged, "jpeg")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+
+	if HasExifSegment(stripped) {
+		t.Fatal("expected StripMetadata's output to have no EXIF segment")
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("decode stripped output: %v", err)
+	}
+
+	r, g, b, _ := decoded.At(4, 4).RGBA()
+	r8, g8, b8 := r>>8, g>>8, b>>8
+	const delta = 4 // JPEG quantization at quality 95 on a flat color is near-lossless.
+	if abs(int(r8)-200) > delta || abs(int(g8)-100) > delta || abs(int(b8)-50) > delta {
+		t.Fatalf("pixel drifted too far after round trip: got (%d,%d,%d)", r8, g8, b8)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package imagetransform resizes and re-encodes a decoded image on demand,
+// the server-side half of GetFilePreview/GetFileThumbnail's w/h/fit/format/q
+// query params. It has no notion of caching or of the filesstore backend --
+// api4's handlers own deciding whether a variant is already cached under
+// model.ImageVariantPath and only call Transform on a miss.
+package imagetransform
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"sync/atomic"
+)
+
+// Fit controls how the source image's aspect ratio is reconciled with the
+// requested Width/Height.
+type Fit string
+
+const (
+	// FitCover scales to fill Width x Height exactly, cropping whichever
+	// dimension overshoots.
+	FitCover Fit = "cover"
+	// FitContain scales to fit entirely within Width x Height, padding
+	// whichever dimension falls short.
+	FitContain Fit = "contain"
+	// FitScale stretches to Width x Height exactly, ignoring aspect ratio.
+	FitScale Fit = "scale"
+)
+
+// Format is the re-encoding target. FormatWebP is accepted by the API as a
+// request value but Transform always rejects it: the standard library has
+// no WebP encoder to re-encode through (the same gap imagesanitize leaves
+// for the same reason).
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+)
+
+// Variant is one entry of the bounded set of dimensions Transform callers
+// are meant to allow, e.g. FileSettings.AllowedImageVariants once that
+// config field exists. DefaultAllowedVariants is a reasonable set of
+// defaults in the meantime.
+type Variant struct {
+	Width  int
+	Height int
+}
+
+// DefaultAllowedVariants bounds the w/h combinations GetFilePreview/
+// GetFileThumbnail will resize to absent a configured allow-list, so a
+// client can't force the server to burn CPU re-encoding arbitrarily large
+// images on every request.
+var DefaultAllowedVariants = []Variant{
+	{Width: 64, Height: 64},
+	{Width: 128, Height: 128},
+	{Width: 256, Height: 256},
+	{Width: 512, Height: 512},
+	{Width: 1024, Height: 1024},
+}
+
+// IsAllowedVariant reports whether width x height appears in allowed.
+func IsAllowedVariant(width, height int, allowed []Variant) bool {
+	for _, v := range allowed {
+		if v.Width == width && v.Height == height {
+			return true
+		}
+	}
+	return false
+}
+
+// Options describes one requested image variant.
+type Options struct {
+	Width   int
+	Height  int
+	Fit     Fit
+	Format  Format
+	Quality int
+}
+
+// ContentType is the MIME type Transform's output should be served with.
+func (o Options) ContentType() string {
+	switch o.Format {
+	case FormatPNG:
+		return "image/png"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// transformCount counts real (non-cached) Transform calls so tests driving
+// the caching layer above this package can assert a second request for the
+// same variant was served from cache instead of re-encoding.
+var transformCount int64
+
+// TransformCallCount returns how many times Transform has actually run.
+func TransformCallCount() int64 {
+	return atomic.LoadInt64(&transformCount)
+}
+
+// ResetTransformCallCount zeroes the counter TransformCallCount reports,
+// so each test starts from a known baseline.
+func ResetTransformCallCount() {
+	atomic.StoreInt64(&transformCount, 0)
+}
+
+// Transform decodes data, resizes it per opts.Fit to opts.Width x
+// opts.Height, and re-encodes it as opts.Format at opts.Quality (JPEG
+// only; ignored for PNG, which is always lossless).
+func Transform(data []byte, opts Options) ([]byte, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return nil, fmt.Errorf("imagetransform: invalid dimensions %dx%d", opts.Width, opts.Height)
+	}
+	if opts.Format == FormatWebP {
+		return nil, fmt.Errorf("imagetransform: webp output is not supported: no standard library encoder")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("imagetransform: decode: %w", err)
+	}
+
+	atomic.AddInt64(&transformCount, 1)
+
+	resized := resize(img, opts.Width, opts.Height, opts.Fit)
+
+	var buf bytes.Buffer
+	switch opts.Format {
+	case FormatPNG:
+		if err := png.Encode(&buf, resized); err != nil {
+			return nil, fmt.Errorf("imagetransform: encode png: %w", err)
+		}
+	default:
+		quality := opts.Quality
+		if quality <= 0 || quality > 100 {
+			quality = 90
+		}
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("imagetransform: encode jpeg: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// resize scales img to width x height according to fit, using
+// nearest-neighbor sampling -- no external dependency offers anything
+// higher quality in this tree, and it's sufficient for chat thumbnails.
+func resize(img image.Image, width, height int, fit Fit) image.Image {
+	srcBounds := img.Bounds()
+	srcW, srcH := srcBounds.Dx(), srcBounds.Dy()
+
+	switch fit {
+	case FitContain:
+		scaledW, scaledH := fitDimensions(srcW, srcH, width, height, FitContain)
+		scaled := resizeNearest(img, scaledW, scaledH)
+		canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(canvas, canvas.Bounds(), image.White, image.ZP, draw.Src)
+		offsetX := (width - scaledW) / 2
+		offsetY := (height - scaledH) / 2
+		draw.Draw(canvas, image.Rect(offsetX, offsetY, offsetX+scaledW, offsetY+scaledH), scaled, image.ZP, draw.Over)
+		return canvas
+	case FitCover:
+		scaledW, scaledH := fitDimensions(srcW, srcH, width, height, FitCover)
+		scaled := resizeNearest(img, scaledW, scaledH)
+		offsetX := (scaledW - width) / 2
+		offsetY := (scaledH - height) / 2
+		canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(canvas, canvas.Bounds(), scaled, image.Pt(offsetX, offsetY), draw.Src)
+		return canvas
+	default: // FitScale
+		return resizeNearest(img, width, height)
+	}
+}
+
+// fitDimensions computes the intermediate scaled size used before cropping
+// (cover) or padding (contain) down to the final width x height.
+func fitDimensions(srcW, srcH, dstW, dstH int, fit Fit) (int, int) {
+	srcAspect := float64(srcW) / float64(srcH)
+	dstAspect := float64(dstW) / float64(dstH)
+
+	wider := srcAspect > dstAspect
+	if fit == FitCover {
+		wider = !wider
+	}
+
+	if wider {
+		return dstW, int(float64(dstW) / srcAspect)
+	}
+	return int(float64(dstH) * srcAspect), dstH
+}
+
+// resizeNearest scales img to exactly width x height, stretching if its
+// aspect ratio doesn't match.
+func resizeNearest(img image.Image, width, height int) *image.RGBA {
+	srcBounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		srcY := srcBounds.Min.Y + y*srcBounds.Dy()/height
+		for x := 0; x < width; x++ {
+			srcX := srcBounds.Min.X + x*srcBounds.Dx()/width
+			dst.Set(x, y, img.At(srcX, srcY))
+		}
+	}
+	return dst
+}
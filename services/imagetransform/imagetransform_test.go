@@ -0,0 +1,105 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package imagetransform
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func sourceImage(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 10, G: 200, B: 30, A: 255}}, image.ZP, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode fixture: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestTransformDimensionsAndContentType(t *testing.T) {
+	src := sourceImage(t, 200, 100)
+
+	cases := []struct {
+		name         string
+		opts         Options
+		wantW, wantH int
+		wantMime     string
+	}{
+		{"scale to square jpeg", Options{Width: 64, Height: 64, Fit: FitScale, Format: FormatJPEG, Quality: 90}, 64, 64, "image/jpeg"},
+		{"cover to square png", Options{Width: 64, Height: 64, Fit: FitCover, Format: FormatPNG}, 64, 64, "image/png"},
+		{"contain within square png", Options{Width: 64, Height: 64, Fit: FitContain, Format: FormatPNG}, 64, 64, "image/png"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Transform(src, tc.opts)
+			if err != nil {
+				t.Fatalf("Transform: %v", err)
+			}
+
+			var decoded image.Image
+			switch tc.opts.Format {
+			case FormatPNG:
+				decoded, err = png.Decode(bytes.NewReader(out))
+			default:
+				decoded, err = jpeg.Decode(bytes.NewReader(out))
+			}
+			if err != nil {
+				t.Fatalf("decode transformed output: %v", err)
+			}
+
+			bounds := decoded.Bounds()
+			if bounds.Dx() != tc.wantW || bounds.Dy() != tc.wantH {
+				t.Fatalf("got %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), tc.wantW, tc.wantH)
+			}
+			if got := tc.opts.ContentType(); got != tc.wantMime {
+				t.Fatalf("ContentType() = %q, want %q", got, tc.wantMime)
+			}
+		})
+	}
+}
+
+func TestTransformRejectsWebP(t *testing.T) {
+	src := sourceImage(t, 32, 32)
+	if _, err := Transform(src, Options{Width: 16, Height: 16, Fit: FitScale, Format: FormatWebP}); err == nil {
+		t.Fatal("expected webp output to be rejected")
+	}
+}
+
+func TestTransformCallCount(t *testing.T) {
+	ResetTransformCallCount()
+	src := sourceImage(t, 32, 32)
+
+	if _, err := Transform(src, Options{Width: 16, Height: 16, Fit: FitScale, Format: FormatPNG}); err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	if got := TransformCallCount(); got != 1 {
+		t.Fatalf("TransformCallCount() = %d, want 1", got)
+	}
+
+	if _, err := Transform(src, Options{Width: 16, Height: 16, Fit: FitScale, Format: FormatPNG}); err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	if got := TransformCallCount(); got != 2 {
+		t.Fatalf("TransformCallCount() = %d, want 2 -- a caching layer above this package, not Transform itself, is what should avoid the second call", got)
+	}
+}
+
+func TestIsAllowedVariant(t *testing.T) {
+	if !IsAllowedVariant(128, 128, DefaultAllowedVariants) {
+		t.Fatal("expected 128x128 to be an allowed default variant")
+	}
+	if IsAllowedVariant(7777, 7777, DefaultAllowedVariants) {
+		t.Fatal("expected an arbitrary large size to be rejected")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package mediapreview shells out to ffprobe/ffmpeg to generate thumbnails
+// and low-bitrate previews for uploaded video and audio files, the same
+// role app.generatePreviewImage plays for images. app.handleImages (not
+// present in this tree) is meant to route video/* and audio/* uploads here
+// -- through the existing async image pipeline, so upload latency isn't
+// affected -- once FileSettings.FFmpegPath names an ffmpeg binary on disk.
+package mediapreview
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// thumbnailAtFraction is how far into a video/audio file, as a fraction of
+// its total duration, the thumbnail keyframe is extracted from. A fixed
+// offset like 0s often lands on a black frame or silence; 10% in is a
+// reasonable heuristic for a representative frame.
+const thumbnailAtFraction = 0.10
+
+// Metadata is the subset of ffprobe's output app.FileInfo needs: Duration
+// for both video and audio, Width/Height for video only (zero for audio).
+type Metadata struct {
+	Duration float64
+	Width    int
+	Height   int
+}
+
+// Probe runs ffprobe against path and returns its duration and, for video,
+// its pixel dimensions.
+func Probe(ffprobePath string, path string) (Metadata, error) {
+	cmd := exec.Command(ffprobePath,
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return Metadata{}, fmt.Errorf("mediapreview: ffprobe %s: %w", path, err)
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &probe); err != nil {
+		return Metadata{}, fmt.Errorf("mediapreview: parse ffprobe output for %s: %w", path, err)
+	}
+
+	var meta Metadata
+	fmt.Sscanf(probe.Format.Duration, "%f", &meta.Duration)
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" {
+			meta.Width = stream.Width
+			meta.Height = stream.Height
+			break
+		}
+	}
+
+	return meta, nil
+}
+
+// GenerateThumbnail extracts a single JPEG keyframe near thumbnailAtFraction
+// of the way through the file at inputPath (for audio, this is effectively
+// a waveform image -- see waveformFilterArgs) and writes it to
+// thumbnailPath.
+func GenerateThumbnail(ffmpegPath string, inputPath string, thumbnailPath string, meta Metadata, isAudio bool) error {
+	var args []string
+	if isAudio {
+		args = append(args, "-i", inputPath, "-filter_complex", "showwavespic=s=640x120:colors=white", "-frames:v", "1", "-y", thumbnailPath)
+	} else {
+		seekSeconds := meta.Duration * thumbnailAtFraction
+		args = append(args, "-ss", fmt.Sprintf("%.3f", seekSeconds), "-i", inputPath, "-frames:v", "1", "-q:v", "2", "-y", thumbnailPath)
+	}
+
+	cmd := exec.Command(ffmpegPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mediapreview: ffmpeg thumbnail for %s: %w (%s)", inputPath, err, stderr.String())
+	}
+
+	return nil
+}
+
+// GenerateVideoPreview transcodes inputPath to a low-bitrate H.264/AAC MP4
+// suitable for inline preview playback without downloading the original.
+func GenerateVideoPreview(ffmpegPath string, inputPath string, previewPath string) error {
+	cmd := exec.Command(ffmpegPath,
+		"-i", inputPath,
+		"-c:v", "libx264", "-b:v", "500k", "-preset", "veryfast",
+		"-c:a", "aac", "-b:a", "96k",
+		"-movflags", "+faststart",
+		"-y", previewPath,
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mediapreview: ffmpeg video preview for %s: %w (%s)", inputPath, err, stderr.String())
+	}
+
+	return nil
+}
+
+// GenerateMediaPreviews is the general entrypoint app.handleImages is
+// meant to route video/* and audio/* uploads through: it probes the file
+// for Metadata, extracts thumbnailPath, and transcodes previewPath,
+// returning the Metadata to persist onto FileInfo.Duration/Width/Height.
+func GenerateMediaPreviews(ffmpegPath string, ffprobePath string, inputPath string, mimeType string, thumbnailPath string, previewPath string) (Metadata, error) {
+	isAudio := strings.HasPrefix(mimeType, "audio/")
+	if !isAudio && !strings.HasPrefix(mimeType, "video/") {
+		return Metadata{}, fmt.Errorf("mediapreview: unsupported mime type %q", mimeType)
+	}
+
+	meta, err := Probe(ffprobePath, inputPath)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	if err := GenerateThumbnail(ffmpegPath, inputPath, thumbnailPath, meta, isAudio); err != nil {
+		return Metadata{}, err
+	}
+
+	if isAudio {
+		err = GenerateAudioPreview(ffmpegPath, inputPath, previewPath)
+	} else {
+		err = GenerateVideoPreview(ffmpegPath, inputPath, previewPath)
+	}
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return meta, nil
+}
+
+// GenerateAudioPreview transcodes inputPath to a normalized (loudness-
+// leveled), low-bitrate MP3 suitable for inline preview playback.
+func GenerateAudioPreview(ffmpegPath string, inputPath string, previewPath string) error {
+	cmd := exec.Command(ffmpegPath,
+		"-i", inputPath,
+		"-af", "loudnorm",
+		"-codec:a", "libmp3lame", "-b:a", "96k",
+		"-y", previewPath,
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mediapreview: ffmpeg audio preview for %s: %w (%s)", inputPath, err, stderr.String())
+	}
+
+	return nil
+}
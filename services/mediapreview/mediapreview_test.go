@@ -0,0 +1,71 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package mediapreview
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// generateTestVideo synthesizes a tiny MP4 with ffmpeg's lavfi testsrc so
+// this test doesn't need a binary fixture checked into the repo.
+func generateTestVideo(t *testing.T, ffmpegPath string, dir string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "test.mp4")
+	cmd := exec.Command(ffmpegPath,
+		"-f", "lavfi", "-i", "testsrc=duration=1:size=64x64:rate=5",
+		"-f", "lavfi", "-i", "sine=duration=1",
+		"-c:v", "libx264", "-c:a", "aac",
+		"-y", path,
+	)
+	if err := cmd.Run(); err != nil {
+		t.Skipf("could not synthesize a test video with ffmpeg: %v", err)
+	}
+
+	return path
+}
+
+func TestGenerateMediaPreviews(t *testing.T) {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg not available")
+	}
+	ffprobePath, err := exec.LookPath("ffprobe")
+	if err != nil {
+		t.Skip("ffprobe not available")
+	}
+
+	dir, err := ioutil.TempDir("", "mediapreview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	videoPath := generateTestVideo(t, ffmpegPath, dir)
+	thumbnailPath := filepath.Join(dir, "test_thumb.jpg")
+	previewPath := filepath.Join(dir, "test_preview.mp4")
+
+	meta, err := GenerateMediaPreviews(ffmpegPath, ffprobePath, videoPath, "video/mp4", thumbnailPath, previewPath)
+	if err != nil {
+		t.Fatalf("GenerateMediaPreviews: %v", err)
+	}
+
+	if meta.Width != 64 || meta.Height != 64 {
+		t.Fatalf("unexpected dimensions: %+v", meta)
+	}
+
+	for _, path := range []string{thumbnailPath, previewPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", path, err)
+		}
+		if info.Size() == 0 {
+			t.Fatalf("expected %s to be non-empty", path)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+// Package s3presign builds AWS SigV4 pre-signed GetObject URLs without
+// depending on the AWS SDK -- this tree has no vendored filestore package
+// (no services/filestore, no AWS SDK) to build on, but SigV4 query-string
+// signing is a pure algorithm over stdlib crypto primitives, so it's
+// implemented here standalone. A real S3 filestore backend, once one
+// exists in this tree, should expose credentials/endpoint through
+// whatever config/connection type it defines; Credentials below is the
+// minimal shape this package actually needs from it.
+package s3presign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials is the subset of AmazonS3* config fields needed to sign a
+// request: FileSettings.AmazonS3AccessKeyId/AmazonS3SecretAccessKey.
+type Credentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+}
+
+// Options addresses and scopes the request being signed, mirroring
+// FileSettings.AmazonS3Endpoint/AmazonS3Region/AmazonS3Bucket/AmazonS3SSL.
+type Options struct {
+	Endpoint string
+	Region   string
+	Bucket   string
+	SSL      bool
+}
+
+const awsService = "s3"
+const amzDateFormat = "20060102T150405Z"
+const amzDateOnlyFormat = "20060102"
+
+// PresignGetObject returns a SigV4 pre-signed URL for an S3 GetObject
+// request against key, valid for expires from now. The signature is bound
+// into the query string (X-Amz-Signature) alongside X-Amz-Expires, so
+// possessing the URL is sufficient -- no Authorization header is needed by
+// whoever follows the redirect.
+func PresignGetObject(creds Credentials, opts Options, key string, expires time.Duration, now time.Time) (string, error) {
+	if creds.AccessKeyId == "" || creds.SecretAccessKey == "" {
+		return "", fmt.Errorf("s3presign: missing credentials")
+	}
+	if opts.Bucket == "" || opts.Endpoint == "" {
+		return "", fmt.Errorf("s3presign: missing bucket or endpoint")
+	}
+
+	scheme := "http"
+	if opts.SSL {
+		scheme = "https"
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	amzDate := now.UTC().Format(amzDateFormat)
+	dateStamp := now.UTC().Format(amzDateOnlyFormat)
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, region, awsService)
+	credential := fmt.Sprintf("%s/%s", creds.AccessKeyId, credentialScope)
+
+	host := opts.Endpoint
+	canonicalURI := "/" + opts.Bucket + "/" + strings.TrimPrefix(key, "/")
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", credential)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int64(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQueryString := canonicalQueryString(query)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		canonicalURI,
+		canonicalQueryString,
+		"host:" + host,
+		"",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		credentialScope,
+		hashHex(canonicalRequest),
+	}, "\n")
+
+	signingKey := signingKey(creds.SecretAccessKey, dateStamp, region, awsService)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	query.Set("X-Amz-Signature", signature)
+
+	return fmt.Sprintf("%s://%s%s?%s", scheme, host, canonicalURI, canonicalQueryString(query)), nil
+}
+
+// canonicalQueryString sorts params by key, as SigV4 requires when
+// computing (and later emitting) the signed query string.
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(query.Get(k)))
+	}
+	return strings.Join(parts, "&")
+}
+
+func hashHex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func signingKey(secretKey, dateStamp, region, service string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, service)
+	return hmacSHA256(kService, "aws4_request")
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package s3presign
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresignGetObjectIncludesSignatureAndExpires(t *testing.T) {
+	creds := Credentials{AccessKeyId: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"}
+	opts := Options{Endpoint: "s3.example.com", Region: "us-east-1", Bucket: "mm-uploads", SSL: true}
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	signed, err := PresignGetObject(creds, opts, "files/abc123", 15*time.Minute, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Scheme != "https" || parsed.Host != "s3.example.com" {
+		t.Fatalf("unexpected host/scheme: %s", signed)
+	}
+	if !strings.HasSuffix(parsed.Path, "/mm-uploads/files/abc123") {
+		t.Fatalf("unexpected path: %s", parsed.Path)
+	}
+
+	q := parsed.Query()
+	if q.Get("X-Amz-Signature") == "" {
+		t.Fatal("expected X-Amz-Signature in presigned URL")
+	}
+	if q.Get("X-Amz-Expires") != "900" {
+		t.Fatalf("expected X-Amz-Expires=900, got %s", q.Get("X-Amz-Expires"))
+	}
+}
+
+func TestPresignGetObjectRequiresCredentialsAndBucket(t *testing.T) {
+	now := time.Now()
+
+	if _, err := PresignGetObject(Credentials{}, Options{Endpoint: "x", Bucket: "y"}, "k", time.Minute, now); err == nil {
+		t.Fatal("expected error for missing credentials")
+	}
+
+	creds := Credentials{AccessKeyId: "a", SecretAccessKey: "b"}
+	if _, err := PresignGetObject(creds, Options{}, "k", time.Minute, now); err == nil {
+		t.Fatal("expected error for missing bucket/endpoint")
+	}
+}
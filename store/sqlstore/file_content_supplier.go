@@ -0,0 +1,120 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/store"
+)
+
+func initSqlSupplierFileContent(sqlStore SqlStore) {
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.FileContent{}, "FileContent").SetKeys(false, "Hash")
+		table.ColMap("Hash").SetMaxSize(64)
+		table.ColMap("Backend").SetMaxSize(64)
+		table.ColMap("StoragePath").SetMaxSize(512)
+	}
+}
+
+// FileContentGetByHash looks up the FileContent row for a digest, if any
+// upload has ever stored that exact content before.
+func (s *SqlSupplier) FileContentGetByHash(ctx context.Context, hash string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var fileContent model.FileContent
+	if err := s.GetReplica().SelectOne(&fileContent, "SELECT * FROM FileContent WHERE Hash = :Hash", map[string]interface{}{"Hash": hash}); err != nil {
+		if err == sql.ErrNoRows {
+			result.Data = (*model.FileContent)(nil)
+			return result
+		}
+		result.Err = model.NewAppError("SqlFileContentStore.FileContentGetByHash", "store.sql_file_content.get_by_hash.app_error", nil, "hash="+hash+", "+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = &fileContent
+
+	return result
+}
+
+// FileContentCreate inserts the first FileContent row for a newly-seen
+// digest, with RefCount 1 for the upload that just stored it.
+func (s *SqlSupplier) FileContentCreate(ctx context.Context, fileContent *model.FileContent, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if err := fileContent.IsValid(); err != nil {
+			result.Err = err
+			return
+		}
+
+		fileContent.RefCount = 1
+
+		if err := s.GetMaster().Insert(fileContent); err != nil {
+			result.Err = model.NewAppError("SqlFileContentStore.FileContentCreate", "store.sql_file_content.create.app_error", nil, "hash="+fileContent.Hash+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = fileContent
+	})
+}
+
+// FileContentIncrementRefCount records that one more FileInfo row now
+// points at this digest's backend object, so a later delete of any single
+// FileInfo doesn't unlink content other rows still reference.
+func (s *SqlSupplier) FileContentIncrementRefCount(ctx context.Context, hash string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if _, err := s.GetMaster().Exec("UPDATE FileContent SET RefCount = RefCount + 1 WHERE Hash = :Hash", map[string]interface{}{"Hash": hash}); err != nil {
+			result.Err = model.NewAppError("SqlFileContentStore.FileContentIncrementRefCount", "store.sql_file_content.increment_ref_count.app_error", nil, "hash="+hash+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = true
+	})
+}
+
+// FileContentDecrementRefCount records that a FileInfo row pointing at this
+// digest was deleted. It returns true when RefCount reached zero, telling
+// the caller it's now safe to unlink the backend object; the row itself is
+// deleted in the same transaction so a concurrent decrement can't unlink
+// twice.
+func (s *SqlSupplier) FileContentDecrementRefCount(ctx context.Context, hash string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		transaction, tErr := s.GetMaster().Begin()
+		if tErr != nil {
+			result.Err = model.NewAppError("SqlFileContentStore.FileContentDecrementRefCount", "store.sql_file_content.decrement_ref_count.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := transaction.Exec("UPDATE FileContent SET RefCount = RefCount - 1 WHERE Hash = :Hash", map[string]interface{}{"Hash": hash}); err != nil {
+			transaction.Rollback()
+			result.Err = model.NewAppError("SqlFileContentStore.FileContentDecrementRefCount", "store.sql_file_content.decrement_ref_count.update_error", nil, "hash="+hash+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		refCount, err := transaction.SelectInt("SELECT RefCount FROM FileContent WHERE Hash = :Hash", map[string]interface{}{"Hash": hash})
+		if err != nil {
+			transaction.Rollback()
+			result.Err = model.NewAppError("SqlFileContentStore.FileContentDecrementRefCount", "store.sql_file_content.decrement_ref_count.select_error", nil, "hash="+hash+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		unlinkable := refCount <= 0
+		if unlinkable {
+			if _, err := transaction.Exec("DELETE FROM FileContent WHERE Hash = :Hash", map[string]interface{}{"Hash": hash}); err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlFileContentStore.FileContentDecrementRefCount", "store.sql_file_content.decrement_ref_count.delete_error", nil, "hash="+hash+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := transaction.Commit(); err != nil {
+			result.Err = model.NewAppError("SqlFileContentStore.FileContentDecrementRefCount", "store.sql_file_content.decrement_ref_count.commit_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = unlinkable
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// TestFileContentCreateInvalid guards the same IsValid-before-DB-access
+// gate FileContentCreate relies on to only ever insert a well-formed row
+// with RefCount 1: an invalid FileContent (here, a truncated hash) must
+// error out of IsValid before touching the database, the same way
+// TestGroupCreateGroupSyncableInvalidType exercises
+// GroupCreateGroupSyncable's invalid-type branch against a zero-value
+// SqlSupplier.
+//
+// A behavioral test of the dedup path itself -- inserting the same hash
+// twice and asserting RefCount increments and FileContentGetByHash returns
+// the shared row -- needs a real database connection to exercise
+// GetMaster()/GetReplica() against, and this trimmed tree has no
+// SqlSupplier constructor, no storetest harness, and no App/Server type to
+// wire one up through; there's nothing in this snapshot to build that test
+// on top of.
+func TestFileContentCreateInvalid(t *testing.T) {
+	s := &SqlSupplier{}
+
+	fileContent := &model.FileContent{
+		Hash:        "too-short",
+		Size:        1024,
+		Backend:     "local",
+		StoragePath: model.ContentAddressedPath("aabbccddeeff00112233445566778899aabbccddeeff00112233445566778899"),
+	}
+
+	result := s.FileContentCreate(context.Background(), fileContent)
+
+	if result.Err == nil {
+		t.Fatal("expected an error for an invalid FileContent")
+	}
+}
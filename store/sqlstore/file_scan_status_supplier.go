@@ -0,0 +1,69 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/store"
+)
+
+func initSqlSupplierFileScanStatuses(sqlStore SqlStore) {
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.FileScanStatus{}, "FileScanStatus").SetKeys(false, "FileId")
+		table.ColMap("FileId").SetMaxSize(26)
+		table.ColMap("Status").SetMaxSize(16)
+		table.ColMap("SignatureName").SetMaxSize(128)
+	}
+}
+
+// FileScanStatusUpsert records the latest scan verdict for fileId,
+// overwriting whatever verdict -- including FILE_SCAN_STATUS_PENDING from
+// the original enqueue -- was there before.
+func (s *SqlSupplier) FileScanStatusUpsert(ctx context.Context, status *model.FileScanStatus, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if err := status.IsValid(); err != nil {
+			result.Err = err
+			return
+		}
+
+		if rowsUpdated, err := s.GetMaster().Update(status); err != nil {
+			result.Err = model.NewAppError("SqlFileScanStatusStore.FileScanStatusUpsert", "store.sql_file_scan_status.upsert.update_error", nil, "file_id="+status.FileId+", "+err.Error(), http.StatusInternalServerError)
+			return
+		} else if rowsUpdated == 0 {
+			if err := s.GetMaster().Insert(status); err != nil {
+				result.Err = model.NewAppError("SqlFileScanStatusStore.FileScanStatusUpsert", "store.sql_file_scan_status.upsert.insert_error", nil, "file_id="+status.FileId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		result.Data = status
+	})
+}
+
+// FileScanStatusGet looks up the current scan verdict for fileId. A file
+// that was uploaded before this feature existed, or whose scanner is
+// disabled, has no row; callers should treat that as FILE_SCAN_STATUS_CLEAN
+// rather than erroring, the same way a disabled filescan.Scanner is
+// treated as "scanning off" rather than a configuration error.
+func (s *SqlSupplier) FileScanStatusGet(ctx context.Context, fileId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var status model.FileScanStatus
+	if err := s.GetReplica().SelectOne(&status, "SELECT * FROM FileScanStatus WHERE FileId = :FileId", map[string]interface{}{"FileId": fileId}); err != nil {
+		if err == sql.ErrNoRows {
+			result.Data = (*model.FileScanStatus)(nil)
+			return result
+		}
+		result.Err = model.NewAppError("SqlFileScanStatusStore.FileScanStatusGet", "store.sql_file_scan_status.get.app_error", nil, "file_id="+fileId+", "+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = &status
+
+	return result
+}
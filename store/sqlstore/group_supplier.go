@@ -8,6 +8,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/mattermost/gorp"
 	"github.com/mattermost/mattermost-server/model"
@@ -24,6 +25,15 @@ type GroupChannel struct {
 	ChannelId string `db:"ChannelId"`
 }
 
+// GroupSidebarCategory links a group to a named sidebar category (SyncableId)
+// scoped to a team (ParentId), so group members' channel memberships can be
+// auto-filed into a predictable sidebar section.
+type GroupSidebarCategory struct {
+	model.GroupSyncable
+	CategoryId string `db:"CategoryId"`
+	TeamId     string `db:"TeamId"`
+}
+
 func initSqlSupplierGroups(sqlStore SqlStore) {
 	for _, db := range sqlStore.GetAllConns() {
 		groups := db.AddTableWithName(model.Group{}, "Groups").SetKeys(false, "Id")
@@ -32,6 +42,7 @@ func initSqlSupplierGroups(sqlStore SqlStore) {
 		groups.ColMap("DisplayName").SetMaxSize(model.GroupDisplayNameMaxLength)
 		groups.ColMap("Description").SetMaxSize(model.GroupDescriptionMaxLength)
 		groups.ColMap("Type").SetMaxSize(model.GroupTypeMaxLength)
+		groups.ColMap("Source").SetMaxSize(model.GroupSourceMaxLength)
 		groups.ColMap("RemoteId").SetMaxSize(model.GroupRemoteIdMaxLength)
 
 		groupMembers := db.AddTableWithName(model.GroupMember{}, "GroupMembers").SetKeys(false, "GroupId", "UserId")
@@ -41,59 +52,73 @@ func initSqlSupplierGroups(sqlStore SqlStore) {
 		groupTeams := db.AddTableWithName(GroupTeam{}, "GroupTeams").SetKeys(false, "GroupId", "TeamId")
 		groupTeams.ColMap("GroupId").SetMaxSize(26)
 		groupTeams.ColMap("TeamId").SetMaxSize(26)
+		groupTeams.ColMap("SchemeRoles").SetMaxSize(64)
 
 		groupChannels := db.AddTableWithName(GroupChannel{}, "GroupChannels").SetKeys(false, "GroupId", "ChannelId")
 		groupChannels.ColMap("GroupId").SetMaxSize(26)
 		groupChannels.ColMap("ChannelId").SetMaxSize(26)
+		groupChannels.ColMap("SchemeRoles").SetMaxSize(64)
+
+		groupSidebarCategories := db.AddTableWithName(GroupSidebarCategory{}, "GroupSidebarCategories").SetKeys(false, "GroupId", "CategoryId")
+		groupSidebarCategories.ColMap("GroupId").SetMaxSize(26)
+		groupSidebarCategories.ColMap("CategoryId").SetMaxSize(26)
+		groupSidebarCategories.ColMap("TeamId").SetMaxSize(26)
 	}
+
+	sqlStore.CreateCompositeIndexIfNotExists("idx_groups_source_remoteid", "Groups", []string{"Source", "RemoteId"})
 }
 
 func (s *SqlSupplier) GroupCreate(ctx context.Context, group *model.Group, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
-	result := store.NewSupplierResult()
-
-	if len(group.Id) != 0 {
-		result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.invalid_group_id", nil, "", http.StatusBadRequest)
-		return result
-	}
-
-	if err := group.IsValidForCreate(); err != nil {
-		result.Err = err
-		return result
-	}
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if len(group.Id) != 0 {
+			result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.invalid_group_id", nil, "", http.StatusBadRequest)
+			return
+		}
 
-	var transaction *gorp.Transaction
-	var tErr error
-	if transaction, tErr = s.GetMaster().Begin(); tErr != nil {
-		result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
-		return result
-	}
+		if err := group.IsValidForCreate(); err != nil {
+			result.Err = err
+			return
+		}
 
-	if err := group.IsValidForCreate(); err != nil {
-		result.Err = err
-		return result
-	}
+		if group.RemoteId != "" {
+			count, sErr := s.GetMaster().SelectInt("SELECT COUNT(*) FROM Groups WHERE Source = :Source AND RemoteId = :RemoteId", map[string]interface{}{"Source": group.Source, "RemoteId": group.RemoteId})
+			if sErr != nil {
+				result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.select_error", nil, sErr.Error(), http.StatusInternalServerError)
+				return
+			}
+			if count > 0 {
+				result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.remote_id_in_use", nil, "source="+string(group.Source)+", remote_id="+group.RemoteId, http.StatusBadRequest)
+				return
+			}
+		}
 
-	group.Id = model.NewId()
-	group.CreateAt = model.GetMillis()
-	group.UpdateAt = group.CreateAt
+		transaction, tErr := s.GetMaster().Begin()
+		if tErr != nil {
+			result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	if err := transaction.Insert(group); err != nil {
-		if IsUniqueConstraintError(err, []string{"Name", "groups_name_key"}) {
-			result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.unique_constraint", nil, err.Error(), http.StatusInternalServerError)
-		} else {
-			result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.insert_error", nil, err.Error(), http.StatusInternalServerError)
+		group.Id = model.NewId()
+		group.CreateAt = model.GetMillis()
+		group.UpdateAt = group.CreateAt
+
+		if err := transaction.Insert(group); err != nil {
+			if IsUniqueConstraintError(err, []string{"Name", "groups_name_key"}) {
+				result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.unique_constraint", nil, err.Error(), http.StatusInternalServerError)
+			} else {
+				result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.insert_error", nil, err.Error(), http.StatusInternalServerError)
+			}
+			transaction.Rollback()
+			return
 		}
-		transaction.Rollback()
-	} else {
-		result.Data = group
-	}
 
-	if err := transaction.Commit(); err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.commit_error", nil, err.Error(), http.StatusInternalServerError)
-		result.Data = nil
-	}
+		if err := transaction.Commit(); err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.GroupCreate", "store.sql_group.create.commit_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	return result
+		result.Data = group
+	})
 }
 
 func (s *SqlSupplier) GroupGet(ctx context.Context, groupId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
@@ -113,214 +138,530 @@ func (s *SqlSupplier) GroupGet(ctx context.Context, groupId string, hints ...sto
 	return result
 }
 
-func (s *SqlSupplier) GroupGetAllPage(ctx context.Context, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+// GroupGetByRemoteID looks up a Group by the id of the upstream directory
+// object (LDAP/SAML) it mirrors, scoped to source so two directories can't
+// collide on the same remote identifier.
+func (s *SqlSupplier) GroupGetByRemoteID(ctx context.Context, remoteID string, source model.GroupSource, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	var groups []*model.Group
+	var group *model.Group
+	if err := s.GetReplica().SelectOne(&group, "SELECT * FROM Groups WHERE RemoteId = :RemoteId AND Source = :Source AND DeleteAt = 0", map[string]interface{}{"RemoteId": remoteID, "Source": source}); err != nil {
+		if err == sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.GetByRemoteID", "store.sql_group.get_by_remote_id.no_rows", nil, err.Error(), http.StatusNotFound)
+		} else {
+			result.Err = model.NewAppError("SqlGroupStore.GetByRemoteID", "store.sql_group.get_by_remote_id.select_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+		return result
+	}
 
-	if _, err := s.GetReplica().Select(&groups, "SELECT * from Groups WHERE DeleteAt = 0 ORDER BY CreateAt DESC LIMIT :Limit OFFSET :Offset", map[string]interface{}{"Limit": limit, "Offset": offset}); err != nil {
+	result.Data = group
+	return result
+}
+
+// GroupGetAllBySource returns every non-deleted group belonging to a given
+// GroupSource, so LDAP/SAML syncers can enumerate what they've already
+// mirrored without scanning by name.
+func (s *SqlSupplier) GroupGetAllBySource(ctx context.Context, source model.GroupSource, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var groups []*model.Group
+	if _, err := s.GetReplica().Select(&groups, "SELECT * FROM Groups WHERE Source = :Source AND DeleteAt = 0 ORDER BY CreateAt", map[string]interface{}{"Source": source}); err != nil {
 		if err != sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.GetAllPage", "store.sql_group.get_all_page.select_error", nil, err.Error(), http.StatusInternalServerError)
+			result.Err = model.NewAppError("SqlGroupStore.GetAllBySource", "store.sql_group.get_all_by_source.select_error", nil, err.Error(), http.StatusInternalServerError)
 			return result
 		}
 	}
 
 	result.Data = groups
-
 	return result
 }
 
-func (s *SqlSupplier) GroupUpdate(ctx context.Context, group *model.Group, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+// GroupSearchGroups answers an admin-UI group picker in a single indexed
+// query: Term prefix-matches Name/DisplayName, Source restricts to one
+// GroupSource, and NotAssociatedToTeamId/NotAssociatedToChannelId exclude
+// groups already synced to that team/channel via a NOT EXISTS against
+// GroupTeams/GroupChannels, so "pick a group to sync to this channel" only
+// offers groups that aren't already linked to it. TotalCount is read off a
+// COUNT(*) OVER() window column on the same query, rather than a second
+// COUNT(*) round trip, since it has to reflect the same WHERE clause anyway.
+func (s *SqlSupplier) GroupSearchGroups(ctx context.Context, opts model.GroupSearchOpts, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	var retrievedGroup *model.Group
-	if err := s.GetMaster().SelectOne(&retrievedGroup, "SELECT * FROM Groups WHERE Id = :Id", map[string]interface{}{"Id": group.Id}); err != nil {
-		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.no_rows", nil, "id="+group.Id+","+err.Error(), http.StatusNotFound)
-		} else {
-			result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.select_error", nil, "id="+group.Id+","+err.Error(), http.StatusInternalServerError)
-		}
-		return result
+	var wheres []string
+	params := map[string]interface{}{
+		"Limit":  opts.PerPage,
+		"Offset": opts.Page * opts.PerPage,
 	}
 
-	// Reset these properties, don't update them based on input
-	group.DeleteAt = retrievedGroup.DeleteAt
-	group.CreateAt = retrievedGroup.CreateAt
-	group.UpdateAt = model.GetMillis()
+	wheres = append(wheres, "Groups.DeleteAt = 0")
 
-	if err := group.IsValidForUpdate(); err != nil {
-		result.Err = err
-		return result
+	if opts.Term != "" {
+		wheres = append(wheres, "(Groups.Name LIKE :Term OR Groups.DisplayName LIKE :Term)")
+		params["Term"] = opts.Term + "%"
 	}
 
-	rowsChanged, err := s.GetMaster().Update(group)
-	if err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.update_error", nil, err.Error(), http.StatusInternalServerError)
-		return result
-	}
-	if rowsChanged != 1 {
-		result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.no_rows_changed", nil, "", http.StatusInternalServerError)
-		return result
+	if opts.Source != "" {
+		wheres = append(wheres, "Groups.Source = :Source")
+		params["Source"] = opts.Source
 	}
 
-	result.Data = group
-	return result
-}
+	if opts.NotAssociatedToTeamId != "" {
+		wheres = append(wheres, `NOT EXISTS (
+			SELECT 1 FROM GroupTeams
+			WHERE GroupTeams.GroupId = Groups.Id
+			AND GroupTeams.TeamId = :NotAssociatedToTeamId
+			AND GroupTeams.DeleteAt = 0
+		)`)
+		params["NotAssociatedToTeamId"] = opts.NotAssociatedToTeamId
+	}
 
-func (s *SqlSupplier) GroupDelete(ctx context.Context, groupID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
-	result := store.NewSupplierResult()
+	if opts.NotAssociatedToChannelId != "" {
+		wheres = append(wheres, `NOT EXISTS (
+			SELECT 1 FROM GroupChannels
+			WHERE GroupChannels.GroupId = Groups.Id
+			AND GroupChannels.ChannelId = :NotAssociatedToChannelId
+			AND GroupChannels.DeleteAt = 0
+		)`)
+		params["NotAssociatedToChannelId"] = opts.NotAssociatedToChannelId
+	}
 
-	if !model.IsValidId(groupID) {
-		result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.invalid_group_id", nil, "Id="+groupID, http.StatusBadRequest)
+	orderBy := "Groups.CreateAt DESC"
+	memberCountJoin := ""
+	switch opts.SortBy {
+	case model.GroupSearchSortByDisplayName:
+		orderBy = "Groups.DisplayName ASC"
+	case model.GroupSearchSortByMemberCount:
+		memberCountJoin = `LEFT JOIN (
+			SELECT GroupId, COUNT(*) AS MemberCount FROM GroupMembers WHERE DeleteAt = 0 GROUP BY GroupId
+		) MemberCounts ON MemberCounts.GroupId = Groups.Id`
+		orderBy = "COALESCE(MemberCounts.MemberCount, 0) DESC"
 	}
 
-	var group *model.Group
-	if err := s.GetReplica().SelectOne(&group, "SELECT * from Groups WHERE Id = :Id", map[string]interface{}{"Id": groupID}); err != nil {
-		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.no_rows", nil, "Id="+groupID+", "+err.Error(), http.StatusNotFound)
-		} else {
-			result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.select_error", nil, err.Error(), http.StatusInternalServerError)
-		}
+	sqlQuery := fmt.Sprintf(`SELECT Groups.*, COUNT(*) OVER() AS TotalCount FROM Groups
+		%s
+		WHERE %s
+		ORDER BY %s
+		LIMIT :Limit OFFSET :Offset`,
+		memberCountJoin, strings.Join(wheres, " AND "), orderBy)
 
-		return result
+	var rows []*struct {
+		model.Group
+		TotalCount int64
 	}
-
-	if group.DeleteAt != 0 {
-		result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.already_deleted", nil, "group_id="+groupID, http.StatusInternalServerError)
-		return result
+	if _, err := s.GetReplica().Select(&rows, sqlQuery, params); err != nil {
+		if err != sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.SearchGroups", "store.sql_group.search_groups.select_error", nil, err.Error(), http.StatusInternalServerError)
+			return result
+		}
 	}
 
-	time := model.GetMillis()
-	group.DeleteAt = time
-	group.UpdateAt = time
-
-	if rowsChanged, err := s.GetMaster().Update(group); err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.update_error", nil, err.Error(), http.StatusInternalServerError)
-	} else if rowsChanged != 1 {
-		result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.no_rows_affected", nil, "no record to update", http.StatusInternalServerError)
-	} else {
-		result.Data = group
+	searchResult := &model.GroupSearchResult{Groups: []*model.Group{}}
+	for i, row := range rows {
+		group := row.Group
+		searchResult.Groups = append(searchResult.Groups, &group)
+		if i == 0 {
+			searchResult.TotalCount = row.TotalCount
+		}
 	}
 
+	result.Data = searchResult
 	return result
 }
 
-func (s *SqlSupplier) GroupCreateMember(ctx context.Context, groupID string, userID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+func (s *SqlSupplier) GroupGetAllPage(ctx context.Context, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	member := &model.GroupMember{
-		GroupId:  groupID,
-		UserId:   userID,
-		CreateAt: model.GetMillis(),
-	}
+	var groups []*model.Group
 
-	if result.Err = member.IsValid(); result.Err != nil {
-		return result
+	if _, err := s.GetReplica().Select(&groups, "SELECT * from Groups WHERE DeleteAt = 0 ORDER BY CreateAt DESC LIMIT :Limit OFFSET :Offset", map[string]interface{}{"Limit": limit, "Offset": offset}); err != nil {
+		if err != sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.GetAllPage", "store.sql_group.get_all_page.select_error", nil, err.Error(), http.StatusInternalServerError)
+			return result
+		}
 	}
 
-	if err := s.GetMaster().Insert(member); err != nil {
-		if IsUniqueConstraintError(err, []string{"GroupId", "UserId", "groupmembers_pkey", "PRIMARY"}) {
-			result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.unique_error", nil, "group_id="+member.GroupId+", user_id="+member.UserId+", "+err.Error(), http.StatusBadRequest)
+	result.Data = groups
+
+	return result
+}
+
+// GroupGetMemberUsers returns every non-deleted User belonging to a group,
+// for admin console panels that need to list a group's full membership
+// without paging.
+func (s *SqlSupplier) GroupGetMemberUsers(ctx context.Context, groupID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var users []*model.User
+	sqlQuery := `SELECT Users.* FROM Users
+			JOIN GroupMembers ON GroupMembers.UserId = Users.Id
+			WHERE GroupMembers.GroupId = :GroupId
+			AND GroupMembers.DeleteAt = 0
+			ORDER BY GroupMembers.CreateAt DESC`
+
+	if _, err := s.GetReplica().Select(&users, sqlQuery, map[string]interface{}{"GroupId": groupID}); err != nil {
+		if err != sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.GetMemberUsers", "store.sql_group.get_member_users.select_error", nil, err.Error(), http.StatusInternalServerError)
 			return result
 		}
-		result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.save.insert_error", nil, "group_id="+member.GroupId+", user_id="+member.UserId+", "+err.Error(), http.StatusInternalServerError)
-		return result
 	}
 
-	var retrievedMember *model.GroupMember
-	if err := s.GetMaster().SelectOne(&retrievedMember, "SELECT * FROM GroupMembers WHERE GroupId = :GroupId AND UserId = :UserId", map[string]interface{}{"GroupId": member.GroupId, "UserId": member.UserId}); err != nil {
-		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.no_rows", nil, "group_id="+member.GroupId+"user_id="+member.UserId+","+err.Error(), http.StatusNotFound)
-		} else {
-			result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.select_error", nil, "group_id="+member.GroupId+"user_id="+member.UserId+","+err.Error(), http.StatusInternalServerError)
+	result.Data = users
+	return result
+}
+
+// GroupGetMemberUsersPage returns a page of non-deleted Users belonging to a
+// group, ordered by when they were added, for admin console panels that list
+// a group's membership without hydrating every member at once.
+func (s *SqlSupplier) GroupGetMemberUsersPage(ctx context.Context, groupID string, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var users []*model.User
+	sqlQuery := `SELECT Users.* FROM Users
+			JOIN GroupMembers ON GroupMembers.UserId = Users.Id
+			WHERE GroupMembers.GroupId = :GroupId
+			AND GroupMembers.DeleteAt = 0
+			ORDER BY GroupMembers.CreateAt DESC
+			LIMIT :Limit OFFSET :Offset`
+
+	if _, err := s.GetReplica().Select(&users, sqlQuery, map[string]interface{}{"GroupId": groupID, "Limit": limit, "Offset": offset}); err != nil {
+		if err != sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.GetMemberUsersPage", "store.sql_group.get_member_users_page.select_error", nil, err.Error(), http.StatusInternalServerError)
+			return result
 		}
-		return result
 	}
-	result.Data = retrievedMember
+
+	result.Data = users
 	return result
 }
 
-func (s *SqlSupplier) GroupDeleteMember(ctx context.Context, groupID string, userID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+// GroupGetGroupsByTeam returns a page of non-deleted Groups synced to the
+// given team, for admin console panels that need to show which groups back
+// a team's membership.
+func (s *SqlSupplier) GroupGetGroupsByTeam(ctx context.Context, teamID string, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	if !model.IsValidId(groupID) {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.invalid_group_id", nil, "", http.StatusBadRequest)
-		return result
-	}
-	if !model.IsValidId(userID) {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.invalid_user_id", nil, "", http.StatusBadRequest)
-		return result
-	}
+	var groups []*model.Group
+	sqlQuery := `SELECT Groups.* FROM Groups
+			JOIN GroupTeams ON GroupTeams.GroupId = Groups.Id
+			WHERE GroupTeams.TeamId = :TeamId
+			AND GroupTeams.DeleteAt = 0
+			AND Groups.DeleteAt = 0
+			ORDER BY Groups.CreateAt DESC
+			LIMIT :Limit OFFSET :Offset`
 
-	var retrievedMember *model.GroupMember
-	if err := s.GetMaster().SelectOne(&retrievedMember, "SELECT * FROM GroupMembers WHERE GroupId = :GroupId AND UserId = :UserId", map[string]interface{}{"GroupId": groupID, "UserId": userID}); err != nil {
-		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.no_rows", nil, "group_id="+groupID+"user_id="+userID+","+err.Error(), http.StatusNotFound)
+	if _, err := s.GetReplica().Select(&groups, sqlQuery, map[string]interface{}{"TeamId": teamID, "Limit": limit, "Offset": offset}); err != nil {
+		if err != sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.GetGroupsByTeam", "store.sql_group.get_groups_by_team.select_error", nil, err.Error(), http.StatusInternalServerError)
 			return result
 		}
-		result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.select_error", nil, "group_id="+groupID+"user_id="+userID+","+err.Error(), http.StatusInternalServerError)
-		return result
 	}
 
-	if retrievedMember.DeleteAt != 0 {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.already_deleted", nil, "group_id="+groupID+"user_id="+userID, http.StatusInternalServerError)
-		return result
-	}
+	result.Data = groups
+	return result
+}
+
+// GroupGetGroupsByChannel returns a page of non-deleted Groups synced to the
+// given channel, for admin console panels that need to show which groups
+// back a channel's membership.
+func (s *SqlSupplier) GroupGetGroupsByChannel(ctx context.Context, channelID string, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
 
-	retrievedMember.DeleteAt = model.GetMillis()
+	var groups []*model.Group
+	sqlQuery := `SELECT Groups.* FROM Groups
+			JOIN GroupChannels ON GroupChannels.GroupId = Groups.Id
+			WHERE GroupChannels.ChannelId = :ChannelId
+			AND GroupChannels.DeleteAt = 0
+			AND Groups.DeleteAt = 0
+			ORDER BY Groups.CreateAt DESC
+			LIMIT :Limit OFFSET :Offset`
 
-	if rowsChanged, err := s.GetMaster().Update(retrievedMember); err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_scheme.delete_member.update_error", nil, err.Error(), http.StatusInternalServerError)
-		return result
-	} else if rowsChanged != 1 {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_scheme.delete_member.no_rows_affected", nil, "no record to update", http.StatusInternalServerError)
-		return result
+	if _, err := s.GetReplica().Select(&groups, sqlQuery, map[string]interface{}{"ChannelId": channelID, "Limit": limit, "Offset": offset}); err != nil {
+		if err != sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.GetGroupsByChannel", "store.sql_group.get_groups_by_channel.select_error", nil, err.Error(), http.StatusInternalServerError)
+			return result
+		}
 	}
 
-	result.Data = retrievedMember
+	result.Data = groups
 	return result
 }
 
+func (s *SqlSupplier) GroupUpdate(ctx context.Context, group *model.Group, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		var retrievedGroup *model.Group
+		if err := s.GetMaster().SelectOne(&retrievedGroup, "SELECT * FROM Groups WHERE Id = :Id", map[string]interface{}{"Id": group.Id}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.no_rows", nil, "id="+group.Id+","+err.Error(), http.StatusNotFound)
+			} else {
+				result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.select_error", nil, "id="+group.Id+","+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Reset these properties, don't update them based on input
+		group.DeleteAt = retrievedGroup.DeleteAt
+		group.CreateAt = retrievedGroup.CreateAt
+		group.UpdateAt = model.GetMillis()
+
+		if err := group.IsValidForUpdate(); err != nil {
+			result.Err = err
+			return
+		}
+
+		rowsChanged, err := s.GetMaster().Update(group)
+		if err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.update_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rowsChanged != 1 {
+			result.Err = model.NewAppError("SqlGroupStore.GroupUpdate", "store.sql_group.update.no_rows_changed", nil, "", http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = group
+	})
+}
+
+func (s *SqlSupplier) GroupDelete(ctx context.Context, groupID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if !model.IsValidId(groupID) {
+			result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.invalid_group_id", nil, "Id="+groupID, http.StatusBadRequest)
+			return
+		}
+
+		var group *model.Group
+		if err := s.GetReplica().SelectOne(&group, "SELECT * from Groups WHERE Id = :Id", map[string]interface{}{"Id": groupID}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.no_rows", nil, "Id="+groupID+", "+err.Error(), http.StatusNotFound)
+			} else {
+				result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.select_error", nil, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if group.DeleteAt != 0 {
+			result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.already_deleted", nil, "group_id="+groupID, http.StatusInternalServerError)
+			return
+		}
+
+		time := model.GetMillis()
+		group.DeleteAt = time
+		group.UpdateAt = time
+
+		rowsChanged, err := s.GetMaster().Update(group)
+		if err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.update_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rowsChanged != 1 {
+			result.Err = model.NewAppError("SqlGroupStore.Delete", "store.sql_group.delete.no_rows_affected", nil, "no record to update", http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = group
+	})
+}
+
+func (s *SqlSupplier) GroupCreateMember(ctx context.Context, groupID string, userID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		member := &model.GroupMember{
+			GroupId:  groupID,
+			UserId:   userID,
+			CreateAt: model.GetMillis(),
+		}
+
+		if result.Err = member.IsValid(); result.Err != nil {
+			return
+		}
+
+		if err := s.GetMaster().Insert(member); err != nil {
+			if IsUniqueConstraintError(err, []string{"GroupId", "UserId", "groupmembers_pkey", "PRIMARY"}) {
+				result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.unique_error", nil, "group_id="+member.GroupId+", user_id="+member.UserId+", "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.save.insert_error", nil, "group_id="+member.GroupId+", user_id="+member.UserId+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var retrievedMember *model.GroupMember
+		if err := s.GetMaster().SelectOne(&retrievedMember, "SELECT * FROM GroupMembers WHERE GroupId = :GroupId AND UserId = :UserId", map[string]interface{}{"GroupId": member.GroupId, "UserId": member.UserId}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.no_rows", nil, "group_id="+member.GroupId+"user_id="+member.UserId+","+err.Error(), http.StatusNotFound)
+			} else {
+				result.Err = model.NewAppError("SqlGroupStore.CreateMember", "store.sql_group.create_member.select_error", nil, "group_id="+member.GroupId+"user_id="+member.UserId+","+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		result.Data = retrievedMember
+	})
+}
+
+func (s *SqlSupplier) GroupDeleteMember(ctx context.Context, groupID string, userID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if !model.IsValidId(groupID) {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.invalid_group_id", nil, "", http.StatusBadRequest)
+			return
+		}
+		if !model.IsValidId(userID) {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.invalid_user_id", nil, "", http.StatusBadRequest)
+			return
+		}
+
+		var retrievedMember *model.GroupMember
+		if err := s.GetMaster().SelectOne(&retrievedMember, "SELECT * FROM GroupMembers WHERE GroupId = :GroupId AND UserId = :UserId", map[string]interface{}{"GroupId": groupID, "UserId": userID}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.no_rows", nil, "group_id="+groupID+"user_id="+userID+","+err.Error(), http.StatusNotFound)
+				return
+			}
+			result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.select_error", nil, "group_id="+groupID+"user_id="+userID+","+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if retrievedMember.DeleteAt != 0 {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_group.delete_member.already_deleted", nil, "group_id="+groupID+"user_id="+userID, http.StatusInternalServerError)
+			return
+		}
+
+		retrievedMember.DeleteAt = model.GetMillis()
+
+		rowsChanged, err := s.GetMaster().Update(retrievedMember)
+		if err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_scheme.delete_member.update_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rowsChanged != 1 {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteMember", "store.sql_scheme.delete_member.no_rows_affected", nil, "no record to update", http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = retrievedMember
+	})
+}
+
+// GroupBulkUpsertMembers adds and removes groupId's membership for a batch of
+// already-resolved (identifier -> user id) pairs inside a single
+// transaction. It checks each row's current membership state before
+// mutating it, the same way CreateChannelMembershipsForGroupSync and
+// DeleteChannelMembershipsForGroupSync check for a race before inserting or
+// deleting, so an identifier that's already a member (or already not one)
+// gets a GroupMemberBulkStatusNoop result instead of a constraint error that
+// would otherwise poison the whole transaction for the rest of the batch.
+func (s *SqlSupplier) GroupBulkUpsertMembers(ctx context.Context, groupId string, add map[string]string, remove map[string]string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		transaction, tErr := s.GetMaster().Begin()
+		if tErr != nil {
+			result.Err = model.NewAppError("SqlGroupStore.GroupBulkUpsertMembers", "store.sql_group.bulk_upsert_members.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var results model.GroupMemberBulkResults
+
+		for identifier, userId := range add {
+			count, cErr := transaction.SelectInt("SELECT COUNT(*) FROM GroupMembers WHERE GroupId = :GroupId AND UserId = :UserId AND DeleteAt = 0", map[string]interface{}{"GroupId": groupId, "UserId": userId})
+			if cErr != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.GroupBulkUpsertMembers", "store.sql_group.bulk_upsert_members.select_error", nil, cErr.Error(), http.StatusInternalServerError)
+				return
+			}
+			if count > 0 {
+				results = append(results, &model.GroupMemberBulkResult{Identifier: identifier, UserId: userId, Status: model.GroupMemberBulkStatusNoop})
+				continue
+			}
+
+			member := &model.GroupMember{GroupId: groupId, UserId: userId, CreateAt: model.GetMillis()}
+			if err := transaction.Insert(member); err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.GroupBulkUpsertMembers", "store.sql_group.bulk_upsert_members.insert_error", nil, "group_id="+groupId+", user_id="+userId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			results = append(results, &model.GroupMemberBulkResult{Identifier: identifier, UserId: userId, Status: model.GroupMemberBulkStatusAdded})
+		}
+
+		for identifier, userId := range remove {
+			var member *model.GroupMember
+			if err := transaction.SelectOne(&member, "SELECT * FROM GroupMembers WHERE GroupId = :GroupId AND UserId = :UserId", map[string]interface{}{"GroupId": groupId, "UserId": userId}); err != nil {
+				if err == sql.ErrNoRows {
+					results = append(results, &model.GroupMemberBulkResult{Identifier: identifier, UserId: userId, Status: model.GroupMemberBulkStatusNoop})
+					continue
+				}
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.GroupBulkUpsertMembers", "store.sql_group.bulk_upsert_members.select_error", nil, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if member.DeleteAt != 0 {
+				results = append(results, &model.GroupMemberBulkResult{Identifier: identifier, UserId: userId, Status: model.GroupMemberBulkStatusNoop})
+				continue
+			}
+
+			member.DeleteAt = model.GetMillis()
+			if _, err := transaction.Update(member); err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.GroupBulkUpsertMembers", "store.sql_group.bulk_upsert_members.update_error", nil, "group_id="+groupId+", user_id="+userId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			results = append(results, &model.GroupMemberBulkResult{Identifier: identifier, UserId: userId, Status: model.GroupMemberBulkStatusRemoved})
+		}
+
+		if err := transaction.Commit(); err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.GroupBulkUpsertMembers", "store.sql_group.bulk_upsert_members.commit_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = results
+	})
+}
+
 func (s *SqlSupplier) GroupCreateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
-	result := store.NewSupplierResult()
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if groupSyncable.SchemeRoles == "" {
+			groupSyncable.SchemeRoles = defaultSchemeRoles(groupSyncable.Type)
+		}
 
-	if err := groupSyncable.IsValid(); err != nil {
-		result.Err = err
-		return result
-	}
+		if err := groupSyncable.IsValid(); err != nil {
+			result.Err = err
+			return
+		}
 
-	// Reset values that shouldn't be updatable by parameter
-	groupSyncable.DeleteAt = 0
-	groupSyncable.CreateAt = model.GetMillis()
-	groupSyncable.UpdateAt = groupSyncable.CreateAt
+		// Reset values that shouldn't be updatable by parameter
+		groupSyncable.DeleteAt = 0
+		groupSyncable.CreateAt = model.GetMillis()
+		groupSyncable.UpdateAt = groupSyncable.CreateAt
 
-	var err error
+		var err error
 
-	switch groupSyncable.Type {
-	case model.GSTeam:
-		err = s.GetMaster().Insert(&GroupTeam{
-			*groupSyncable,
-			groupSyncable.SyncableId,
-		})
-	case model.GSChannel:
-		err = s.GetMaster().Insert(&GroupChannel{
-			*groupSyncable,
-			groupSyncable.SyncableId,
-		})
-	default:
-		model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId+", "+err.Error(), http.StatusInternalServerError)
-		return result
-	}
-	if err != nil {
-		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.no_rows_affected", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
+		switch groupSyncable.Type {
+		case model.GSTeam:
+			err = s.GetMaster().Insert(&GroupTeam{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+			})
+		case model.GSChannel:
+			err = s.GetMaster().Insert(&GroupChannel{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+			})
+		case model.GSSidebarCategory:
+			err = s.GetMaster().Insert(&GroupSidebarCategory{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+				groupSyncable.ParentId,
+			})
+		default:
+			result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.no_rows_affected", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
+				return
+			}
+			result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.insert_error", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId+", "+err.Error(), http.StatusInternalServerError)
+			return
 		}
-		result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.insert_error", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId+", "+err.Error(), http.StatusInternalServerError)
-		return result
-	}
 
-	result.Data = groupSyncable
-	return result
+		result.Data = groupSyncable
+	})
 }
 
 func (s *SqlSupplier) GroupGetGroupSyncable(ctx context.Context, groupID string, syncableID string, syncableType model.GroupSyncableType, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
@@ -348,6 +689,8 @@ func (s *SqlSupplier) getGroupSyncable(groupID string, syncableID string, syncab
 		getResult, err = s.GetMaster().Get(GroupTeam{}, groupID, syncableID)
 	case model.GSChannel:
 		getResult, err = s.GetMaster().Get(GroupChannel{}, groupID, syncableID)
+	case model.GSSidebarCategory:
+		getResult, err = s.GetMaster().Get(GroupSidebarCategory{}, groupID, syncableID)
 	default:
 	}
 	if err != nil {
@@ -380,6 +723,17 @@ func (s *SqlSupplier) getGroupSyncable(groupID string, syncableID string, syncab
 		groupSyncable.DeleteAt = groupChannel.DeleteAt
 		groupSyncable.UpdateAt = groupChannel.UpdateAt
 		groupSyncable.Type = groupChannel.Type
+	case model.GSSidebarCategory:
+		groupSidebarCategory := getResult.(*GroupSidebarCategory)
+		groupSyncable.SyncableId = groupSidebarCategory.CategoryId
+		groupSyncable.ParentId = groupSidebarCategory.TeamId
+		groupSyncable.GroupId = groupSidebarCategory.GroupId
+		groupSyncable.CanLeave = groupSidebarCategory.CanLeave
+		groupSyncable.AutoAdd = groupSidebarCategory.AutoAdd
+		groupSyncable.CreateAt = groupSidebarCategory.CreateAt
+		groupSyncable.DeleteAt = groupSidebarCategory.DeleteAt
+		groupSyncable.UpdateAt = groupSidebarCategory.UpdateAt
+		groupSyncable.Type = groupSidebarCategory.Type
 	default:
 		return nil, fmt.Errorf("unable to convert syncableType: %s", syncableType.String())
 	}
@@ -392,14 +746,15 @@ func (s *SqlSupplier) GroupGetAllGroupSyncablesByGroupPage(ctx context.Context,
 
 	type GroupSyncableScanner struct {
 		model.GroupSyncable
-		TeamId    string
-		ChannelId string
+		TeamId     string
+		ChannelId  string
+		CategoryId string
 	}
 
 	var groupSyncableScanners []*GroupSyncableScanner
 	groupSyncables := []*model.GroupSyncable{}
 
-	sqlQuery := fmt.Sprintf("SELECT * from Group%[1]ss WHERE GroupId = :GroupId ORDER BY CreateAt DESC LIMIT :Limit OFFSET :Offset", syncableType.String())
+	sqlQuery := fmt.Sprintf("SELECT * from %s WHERE GroupId = :GroupId ORDER BY CreateAt DESC LIMIT :Limit OFFSET :Offset", groupSyncableTableName(syncableType))
 
 	if _, err := s.GetReplica().Select(&groupSyncableScanners, sqlQuery, map[string]interface{}{"GroupId": groupID, "Limit": limit, "Offset": offset}); err != nil {
 		if err == sql.ErrNoRows {
@@ -424,6 +779,9 @@ func (s *SqlSupplier) GroupGetAllGroupSyncablesByGroupPage(ctx context.Context,
 			gs.SyncableId = gsScan.TeamId
 		case model.GSChannel:
 			gs.SyncableId = gsScan.ChannelId
+		case model.GSSidebarCategory:
+			gs.SyncableId = gsScan.CategoryId
+			gs.ParentId = gsScan.TeamId
 		default:
 			continue
 		}
@@ -434,59 +792,94 @@ func (s *SqlSupplier) GroupGetAllGroupSyncablesByGroupPage(ctx context.Context,
 	return result
 }
 
-func (s *SqlSupplier) GroupUpdateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+// GroupGetGroupSyncablesDueForSync returns non-deleted syncables of the
+// given type whose NextSyncAt has elapsed and, if a sync window is
+// configured, whose window currently admits a run. The job runner is
+// expected to process the results and then call GroupAdvanceNextSyncAt so
+// the same rows aren't picked up again until their next interval elapses.
+func (s *SqlSupplier) GroupGetGroupSyncablesDueForSync(ctx context.Context, syncableType model.GroupSyncableType, now int64, minuteOfDay int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	retrievedGroupSyncable, err := s.getGroupSyncable(groupSyncable.GroupId, groupSyncable.SyncableId, groupSyncable.Type)
-	if err != nil {
+	type GroupSyncableScanner struct {
+		model.GroupSyncable
+		TeamId     string
+		ChannelId  string
+		CategoryId string
+	}
+
+	var scanners []*GroupSyncableScanner
+	groupSyncables := []*model.GroupSyncable{}
+
+	sqlQuery := fmt.Sprintf("SELECT * from %s WHERE DeleteAt = 0 AND NextSyncAt <= :Now ORDER BY NextSyncAt ASC", groupSyncableTableName(syncableType))
+
+	if _, err := s.GetReplica().Select(&scanners, sqlQuery, map[string]interface{}{"Now": now}); err != nil {
 		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_rows", nil, err.Error(), http.StatusInternalServerError)
+			result.Data = groupSyncables
 			return result
 		}
-		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.select_error", nil, "GroupId="+groupSyncable.GroupId+", SyncableId="+groupSyncable.SyncableId+", SyncableType="+groupSyncable.Type.String()+", "+err.Error(), http.StatusInternalServerError)
+		result.Err = model.NewAppError("SqlGroupStore.GetGroupSyncablesDueForSync", "store.sql_group.get_group_syncables_due_for_sync.select_error", nil, err.Error(), http.StatusInternalServerError)
 		return result
 	}
 
-	if err := groupSyncable.IsValid(); err != nil {
-		result.Err = err
-		return result
+	for _, scan := range scanners {
+		gs := scan.GroupSyncable
+		gs.Type = syncableType
+		switch syncableType {
+		case model.GSTeam:
+			gs.SyncableId = scan.TeamId
+		case model.GSChannel:
+			gs.SyncableId = scan.ChannelId
+		case model.GSSidebarCategory:
+			gs.SyncableId = scan.CategoryId
+			gs.ParentId = scan.TeamId
+		default:
+			continue
+		}
+		if gs.InSyncWindow(minuteOfDay) {
+			groupSyncables = append(groupSyncables, &gs)
+		}
 	}
 
-	// Check if no update is required
-	if (retrievedGroupSyncable.AutoAdd == groupSyncable.AutoAdd) && (retrievedGroupSyncable.CanLeave == groupSyncable.CanLeave) {
-		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_change", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
-		return result
-	}
+	result.Data = groupSyncables
+	return result
+}
 
-	// Reset these properties, don't update them based on input
-	groupSyncable.DeleteAt = retrievedGroupSyncable.DeleteAt
-	groupSyncable.CreateAt = retrievedGroupSyncable.CreateAt
-	groupSyncable.UpdateAt = model.GetMillis()
+// GroupAdvanceNextSyncAt bumps a syncable's NextSyncAt by its configured
+// SyncIntervalSeconds (or leaves it due immediately if syncing on every job
+// tick), so a finished sync pass isn't re-picked by
+// GroupGetGroupSyncablesDueForSync before its next interval elapses.
+func (s *SqlSupplier) GroupAdvanceNextSyncAt(ctx context.Context, groupSyncable *model.GroupSyncable, now int64, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	if groupSyncable.SyncIntervalSeconds > 0 {
+		groupSyncable.NextSyncAt = now + groupSyncable.SyncIntervalSeconds*1000
+	}
 
-	var rowsAffected int64
+	var err error
 	switch groupSyncable.Type {
 	case model.GSTeam:
-		rowsAffected, err = s.GetMaster().Update(&GroupTeam{
+		_, err = s.GetMaster().Update(&GroupTeam{
 			*groupSyncable,
 			groupSyncable.SyncableId,
 		})
 	case model.GSChannel:
-		rowsAffected, err = s.GetMaster().Update(&GroupChannel{
+		_, err = s.GetMaster().Update(&GroupChannel{
 			*groupSyncable,
 			groupSyncable.SyncableId,
 		})
+	case model.GSSidebarCategory:
+		_, err = s.GetMaster().Update(&GroupSidebarCategory{
+			*groupSyncable,
+			groupSyncable.SyncableId,
+			groupSyncable.ParentId,
+		})
 	default:
-		model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId+", "+err.Error(), http.StatusInternalServerError)
+		result.Err = model.NewAppError("SqlGroupStore.AdvanceNextSyncAt", "store.sql_group.advance_next_sync_at.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
 		return result
 	}
 
 	if err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.update_error", nil, err.Error(), http.StatusInternalServerError)
-		return result
-	}
-
-	if rowsAffected == 0 {
-		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_rows", nil, "GroupId="+groupSyncable.GroupId+", SyncableId="+groupSyncable.SyncableId+", SyncableType="+groupSyncable.Type.String()+", "+err.Error(), http.StatusInternalServerError)
+		result.Err = model.NewAppError("SqlGroupStore.AdvanceNextSyncAt", "store.sql_group.advance_next_sync_at.update_error", nil, err.Error(), http.StatusInternalServerError)
 		return result
 	}
 
@@ -494,78 +887,229 @@ func (s *SqlSupplier) GroupUpdateGroupSyncable(ctx context.Context, groupSyncabl
 	return result
 }
 
-func (s *SqlSupplier) GroupDeleteGroupSyncable(ctx context.Context, groupID string, syncableID string, syncableType model.GroupSyncableType, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
-	result := store.NewSupplierResult()
+func (s *SqlSupplier) GroupUpdateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		retrievedGroupSyncable, err := s.getGroupSyncable(groupSyncable.GroupId, groupSyncable.SyncableId, groupSyncable.Type)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_rows", nil, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.select_error", nil, "GroupId="+groupSyncable.GroupId+", SyncableId="+groupSyncable.SyncableId+", SyncableType="+groupSyncable.Type.String()+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	if !model.IsValidId(groupID) {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.invalid_group_id", nil, "group_id="+groupID, http.StatusBadRequest)
-		return result
-	}
+		if err := groupSyncable.IsValid(); err != nil {
+			result.Err = err
+			return
+		}
 
-	if !model.IsValidId(string(syncableID)) {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.invalid_syncable_id", nil, "group_id="+groupID, http.StatusBadRequest)
-		return result
-	}
+		schemeRolesChanged := retrievedGroupSyncable.SchemeRoles != groupSyncable.SchemeRoles
 
-	groupSyncable, err := s.getGroupSyncable(groupID, syncableID, syncableType)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.no_rows", nil, "Id="+groupID+", "+err.Error(), http.StatusNotFound)
-		} else {
-			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.select_error", nil, err.Error(), http.StatusInternalServerError)
+		// Check if no update is required
+		if (retrievedGroupSyncable.AutoAdd == groupSyncable.AutoAdd) && (retrievedGroupSyncable.CanLeave == groupSyncable.CanLeave) && !schemeRolesChanged {
+			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_change", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
+			return
 		}
-		return result
+
+		// Reset these properties, don't update them based on input
+		groupSyncable.DeleteAt = retrievedGroupSyncable.DeleteAt
+		groupSyncable.CreateAt = retrievedGroupSyncable.CreateAt
+		groupSyncable.UpdateAt = model.GetMillis()
+
+		var rowsAffected int64
+		switch groupSyncable.Type {
+		case model.GSTeam:
+			rowsAffected, err = s.GetMaster().Update(&GroupTeam{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+			})
+		case model.GSChannel:
+			rowsAffected, err = s.GetMaster().Update(&GroupChannel{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+			})
+		case model.GSSidebarCategory:
+			rowsAffected, err = s.GetMaster().Update(&GroupSidebarCategory{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+				groupSyncable.ParentId,
+			})
+		default:
+			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
+			return
+		}
+
+		if err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.update_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if rowsAffected == 0 {
+			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_rows", nil, "GroupId="+groupSyncable.GroupId+", SyncableId="+groupSyncable.SyncableId+", SyncableType="+groupSyncable.Type.String(), http.StatusInternalServerError)
+			return
+		}
+
+		if schemeRolesChanged {
+			if err := s.reconcileGroupSyncableSchemeRoles(groupSyncable); err != nil {
+				result.Err = err
+				return
+			}
+		}
+
+		result.Data = groupSyncable
+	})
+}
+
+// groupSyncableTableName returns the name of the table backing a given
+// GroupSyncableType. It can't simply pluralize syncableType.String() because
+// "SidebarCategory" pluralizes irregularly ("GroupSidebarCategories").
+func groupSyncableTableName(syncableType model.GroupSyncableType) string {
+	switch syncableType {
+	case model.GSTeam:
+		return "GroupTeams"
+	case model.GSChannel:
+		return "GroupChannels"
+	case model.GSSidebarCategory:
+		return "GroupSidebarCategories"
+	default:
+		return ""
 	}
+}
 
-	if groupSyncable.DeleteAt != 0 {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.already_deleted", nil, "group_id="+groupID+"syncable_id="+syncableID, http.StatusBadRequest)
-		return result
+// defaultSchemeRoles returns the base, non-admin role granted to users
+// auto-added through a syncable whose SchemeRoles has not been set.
+func defaultSchemeRoles(syncableType model.GroupSyncableType) string {
+	switch syncableType {
+	case model.GSTeam:
+		return model.TEAM_USER_ROLE_ID
+	case model.GSChannel:
+		return model.CHANNEL_USER_ROLE_ID
+	default:
+		return ""
 	}
+}
 
-	time := model.GetMillis()
-	groupSyncable.DeleteAt = time
-	groupSyncable.UpdateAt = time
+// reconcileGroupSyncableSchemeRoles applies a syncable's current SchemeRoles
+// to every existing TeamMember/ChannelMember that was auto-added through it,
+// so editing SchemeRoles on an existing syncable takes effect immediately
+// instead of only for future auto-adds.
+func (s *SqlSupplier) reconcileGroupSyncableSchemeRoles(groupSyncable *model.GroupSyncable) *model.AppError {
+	var updateSql string
 
-	var rowsAffected int64
 	switch groupSyncable.Type {
 	case model.GSTeam:
-		rowsAffected, err = s.GetMaster().Update(&GroupTeam{
-			*groupSyncable,
-			groupSyncable.SyncableId,
-		})
+		updateSql = `UPDATE TeamMembers SET Roles = :Roles
+			WHERE TeamId = :SyncableId
+			AND UserId IN (SELECT UserId FROM GroupMembers WHERE GroupId = :GroupId AND DeleteAt = 0)`
 	case model.GSChannel:
-		rowsAffected, err = s.GetMaster().Update(&GroupChannel{
-			*groupSyncable,
-			groupSyncable.SyncableId,
-		})
+		updateSql = `UPDATE ChannelMembers SET Roles = :Roles
+			WHERE ChannelId = :SyncableId
+			AND UserId IN (SELECT UserId FROM GroupMembers WHERE GroupId = :GroupId AND DeleteAt = 0)`
 	default:
-		model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId+", "+err.Error(), http.StatusInternalServerError)
-		return result
+		return model.NewAppError("SqlGroupStore.reconcileGroupSyncableSchemeRoles", "store.sql_group.reconcile_scheme_roles.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
 	}
 
-	if err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.update_error", nil, err.Error(), http.StatusInternalServerError)
-		return result
+	if _, err := s.GetMaster().Exec(updateSql, map[string]interface{}{
+		"Roles":      groupSyncable.SchemeRoles,
+		"SyncableId": groupSyncable.SyncableId,
+		"GroupId":    groupSyncable.GroupId,
+	}); err != nil {
+		return model.NewAppError("SqlGroupStore.reconcileGroupSyncableSchemeRoles", "store.sql_group.reconcile_scheme_roles.update_error", nil, err.Error(), http.StatusInternalServerError)
 	}
 
-	if rowsAffected == 0 {
-		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.no_rows_affected", nil, "", http.StatusInternalServerError)
-		return result
+	return nil
+}
+
+// MigrateGroupSyncableSchemeRoles backfills SchemeRoles on any GroupTeams/
+// GroupChannels rows left over from before this field existed, so upgraded
+// installations keep today's "plain member" auto-add behavior.
+func (s *SqlSupplier) MigrateGroupSyncableSchemeRoles() *model.AppError {
+	if _, err := s.GetMaster().Exec("UPDATE GroupTeams SET SchemeRoles = :Roles WHERE SchemeRoles = ''", map[string]interface{}{"Roles": model.TEAM_USER_ROLE_ID}); err != nil {
+		return model.NewAppError("SqlGroupStore.MigrateGroupSyncableSchemeRoles", "store.sql_group.migrate_scheme_roles.update_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+	if _, err := s.GetMaster().Exec("UPDATE GroupChannels SET SchemeRoles = :Roles WHERE SchemeRoles = ''", map[string]interface{}{"Roles": model.CHANNEL_USER_ROLE_ID}); err != nil {
+		return model.NewAppError("SqlGroupStore.MigrateGroupSyncableSchemeRoles", "store.sql_group.migrate_scheme_roles.update_error", nil, err.Error(), http.StatusInternalServerError)
 	}
+	return nil
+}
 
-	result.Data = groupSyncable
+func (s *SqlSupplier) GroupDeleteGroupSyncable(ctx context.Context, groupID string, syncableID string, syncableType model.GroupSyncableType, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if !model.IsValidId(groupID) {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.invalid_group_id", nil, "group_id="+groupID, http.StatusBadRequest)
+			return
+		}
 
-	return result
+		if !model.IsValidId(string(syncableID)) {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.invalid_syncable_id", nil, "group_id="+groupID, http.StatusBadRequest)
+			return
+		}
+
+		groupSyncable, err := s.getGroupSyncable(groupID, syncableID, syncableType)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.no_rows", nil, "Id="+groupID+", "+err.Error(), http.StatusNotFound)
+			} else {
+				result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.select_error", nil, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if groupSyncable.DeleteAt != 0 {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.already_deleted", nil, "group_id="+groupID+"syncable_id="+syncableID, http.StatusBadRequest)
+			return
+		}
+
+		time := model.GetMillis()
+		groupSyncable.DeleteAt = time
+		groupSyncable.UpdateAt = time
+
+		var rowsAffected int64
+		switch groupSyncable.Type {
+		case model.GSTeam:
+			rowsAffected, err = s.GetMaster().Update(&GroupTeam{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+			})
+		case model.GSChannel:
+			rowsAffected, err = s.GetMaster().Update(&GroupChannel{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+			})
+		case model.GSSidebarCategory:
+			rowsAffected, err = s.GetMaster().Update(&GroupSidebarCategory{
+				*groupSyncable,
+				groupSyncable.SyncableId,
+				groupSyncable.ParentId,
+			})
+		default:
+			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.invalid_syncable_type", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
+			return
+		}
+
+		if err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.update_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if rowsAffected == 0 {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.no_rows_affected", nil, "", http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = groupSyncable
+	})
 }
 
-// PendingAutoAddTeamMemberships returns a slice of [UserIds, TeamIds] tuples that need newly created
-// memberships as configured by groups.
+// PendingAutoAddTeamMemberships returns the (UserId, TeamId) pairs that need
+// newly created memberships as configured by groups.
 //
 // Typically minGroupMembersCreateAt will be the last successful group sync time.
 func (s *SqlSupplier) PendingAutoAddTeamMemberships(ctx context.Context, minGroupMembersCreateAt int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	sql := `SELECT GroupMembers.UserId, GroupTeams.SyncableId
+	sql := `SELECT GroupMembers.UserId, GroupTeams.SyncableId AS TeamId
 			FROM GroupMembers
 			JOIN GroupTeams ON GroupTeams.GroupId = GroupMembers.GroupId
 			JOIN Groups ON Groups.Id = GroupMembers.GroupId
@@ -577,45 +1121,584 @@ func (s *SqlSupplier) PendingAutoAddTeamMemberships(ctx context.Context, minGrou
 			AND GroupMembers.DeleteAt = 0
 			AND GroupMembers.CreateAt >= :MinGroupMembersCreateAt`
 
-	sqlResult, err := s.GetMaster().Exec(sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt})
-	if err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddTeamMemberships", "store.sql_group.select_error", nil, "", http.StatusInternalServerError)
+	var pairs []*model.UserTeamIDPair
+	if _, err := s.GetReplica().Select(&pairs, sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddTeamMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
 	}
 
-	result.Data = sqlResult
+	result.Data = pairs
 
 	return result
 }
 
-// PendingAutoAddChannelMemberships returns a slice [UserIds, ChannelIds] tuples that need newly created
-// memberships as configured by groups.
+// PendingAutoAddChannelMemberships returns a page of the (UserId, ChannelId)
+// pairs that need newly created memberships as configured by groups, ordered
+// by GroupMembers.CreateAt, UserId, ChannelId so a paginated caller (e.g. the
+// group-sync worker) sees a stable cursor across restarts.
 //
 // Typically minGroupMembersCreateAt will be the last successful group sync time.
-func (s *SqlSupplier) PendingAutoAddChannelMemberships(minGroupMembersCreateAt int) *store.LayeredStoreSupplierResult {
+func (s *SqlSupplier) PendingAutoAddChannelMemberships(ctx context.Context, minGroupMembersCreateAt int64, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	sql := `SELECT GroupMembers.UserId, GroupChannels.ChannelId
+	sqlQuery := `SELECT GroupMembers.UserId, GroupChannels.ChannelId
 			FROM GroupMembers
 			JOIN GroupChannels ON GroupChannels.GroupId = GroupMembers.GroupId
 			JOIN Groups ON Groups.Id = GroupMembers.GroupId
-			JOIN Channels ON Channels.Id = GroupChannels.ChannelId
-			JOIN Teams ON Teams.Id = Channels.SyncableId
-			JOIN TeamMembers ON TeamMembers.SyncableId = Teams.Id AND TeamMembers.UserId = GroupMembers.UserId
-			FULL JOIN ChannelMemberHistory ON ChannelMemberHistory.ChannelId = GroupChannels.ChannelId AND ChannelMemberHistory.UserId = GroupMembers.UserId
-			WHERE ChannelMemberHistory.UserId IS NULL
-			AND ChannelMemberHistory.LeaveTime IS NULL
+			FULL JOIN ChannelMembers ON ChannelMembers.ChannelId = GroupChannels.ChannelId AND ChannelMembers.UserId = GroupMembers.UserId
+			WHERE ChannelMembers.UserId IS NULL
 			AND Groups.DeleteAt = 0
 			AND GroupChannels.DeleteAt = 0
 			AND GroupChannels.AutoAdd = true
 			AND GroupMembers.DeleteAt = 0
-			AND GroupMembers.CreateAt >= :MinGroupMembersCreateAt`
+			AND GroupMembers.CreateAt >= :MinGroupMembersCreateAt
+			ORDER BY GroupMembers.CreateAt, GroupMembers.UserId, GroupChannels.ChannelId
+			LIMIT :Limit OFFSET :Offset`
 
-	sqlResult, err := s.GetMaster().Exec(sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt})
-	if err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddChannelMemberships", "store.sql_group.select_error", nil, "", http.StatusInternalServerError)
+	var pairs []*model.UserChannelIDPair
+	if _, err := s.GetReplica().Select(&pairs, sqlQuery, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt, "Limit": limit, "Offset": offset}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddChannelMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
 	}
 
-	result.Data = sqlResult
+	result.Data = pairs
 
 	return result
 }
+
+// CreateChannelMembershipsForGroupSync inserts a ChannelMember and matching
+// ChannelMemberHistory row for each pair inside a single transaction, so the
+// group-sync worker can safely re-submit a page of pending pairs after a
+// restart: any pair that raced with a manual add (and so already has a
+// ChannelMember row) is skipped instead of failing the whole batch.
+func (s *SqlSupplier) CreateChannelMembershipsForGroupSync(ctx context.Context, pairs []*model.UserChannelIDPair, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		transaction, tErr := s.GetMaster().Begin()
+		if tErr != nil {
+			result.Err = model.NewAppError("SqlGroupStore.CreateChannelMembershipsForGroupSync", "store.sql_group.create_channel_memberships_for_group_sync.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var created []*model.ChannelMember
+		for _, pair := range pairs {
+			count, cErr := transaction.SelectInt("SELECT COUNT(*) FROM ChannelMembers WHERE ChannelId = :ChannelId AND UserId = :UserId", map[string]interface{}{"ChannelId": pair.ChannelId, "UserId": pair.UserId})
+			if cErr != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.CreateChannelMembershipsForGroupSync", "store.sql_group.create_channel_memberships_for_group_sync.select_error", nil, cErr.Error(), http.StatusInternalServerError)
+				return
+			}
+			if count > 0 {
+				// Raced with a manual add; leave the existing membership alone.
+				continue
+			}
+
+			roles, rErr := transaction.SelectStr(
+				"SELECT SchemeRoles FROM GroupChannels WHERE ChannelId = :ChannelId AND DeleteAt = 0 AND AutoAdd = true LIMIT 1",
+				map[string]interface{}{"ChannelId": pair.ChannelId},
+			)
+			if rErr != nil && rErr != sql.ErrNoRows {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.CreateChannelMembershipsForGroupSync", "store.sql_group.create_channel_memberships_for_group_sync.roles_select_error", nil, "channel_id="+pair.ChannelId+", "+rErr.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			member := &model.ChannelMember{
+				ChannelId: pair.ChannelId,
+				UserId:    pair.UserId,
+				Roles:     roles,
+			}
+
+			if err := transaction.Insert(member); err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.CreateChannelMembershipsForGroupSync", "store.sql_group.create_channel_memberships_for_group_sync.insert_error", nil, "channel_id="+pair.ChannelId+", user_id="+pair.UserId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if _, err := transaction.Exec("INSERT INTO ChannelMemberHistory (ChannelId, UserId, JoinTime) VALUES (:ChannelId, :UserId, :JoinTime)",
+				map[string]interface{}{"ChannelId": pair.ChannelId, "UserId": pair.UserId, "JoinTime": model.GetMillis()}); err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.CreateChannelMembershipsForGroupSync", "store.sql_group.create_channel_memberships_for_group_sync.history_insert_error", nil, "channel_id="+pair.ChannelId+", user_id="+pair.UserId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			created = append(created, member)
+		}
+
+		if err := transaction.Commit(); err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.CreateChannelMembershipsForGroupSync", "store.sql_group.create_channel_memberships_for_group_sync.commit_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = created
+	})
+}
+
+// DeleteChannelMembershipsForGroupSync is the inverse of
+// CreateChannelMembershipsForGroupSync: inside a single transaction it
+// deletes the ChannelMember row for each pair and stamps LeaveTime on its
+// still-open ChannelMemberHistory row, skipping any pair that raced with a
+// manual remove (and so has no ChannelMember row left to delete).
+func (s *SqlSupplier) DeleteChannelMembershipsForGroupSync(ctx context.Context, pairs []*model.UserChannelIDPair, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		transaction, tErr := s.GetMaster().Begin()
+		if tErr != nil {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteChannelMembershipsForGroupSync", "store.sql_group.delete_channel_memberships_for_group_sync.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var removed int
+		for _, pair := range pairs {
+			sqlResult, err := transaction.Exec("DELETE FROM ChannelMembers WHERE ChannelId = :ChannelId AND UserId = :UserId",
+				map[string]interface{}{"ChannelId": pair.ChannelId, "UserId": pair.UserId})
+			if err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.DeleteChannelMembershipsForGroupSync", "store.sql_group.delete_channel_memberships_for_group_sync.delete_error", nil, "channel_id="+pair.ChannelId+", user_id="+pair.UserId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			rowsAffected, raErr := sqlResult.RowsAffected()
+			if raErr != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.DeleteChannelMembershipsForGroupSync", "store.sql_group.delete_channel_memberships_for_group_sync.rows_affected_error", nil, raErr.Error(), http.StatusInternalServerError)
+				return
+			}
+			if rowsAffected == 0 {
+				// Raced with a manual remove; nothing left to do for this pair.
+				continue
+			}
+
+			if _, err := transaction.Exec("UPDATE ChannelMemberHistory SET LeaveTime = :LeaveTime WHERE ChannelId = :ChannelId AND UserId = :UserId AND LeaveTime IS NULL",
+				map[string]interface{}{"ChannelId": pair.ChannelId, "UserId": pair.UserId, "LeaveTime": model.GetMillis()}); err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.DeleteChannelMembershipsForGroupSync", "store.sql_group.delete_channel_memberships_for_group_sync.history_update_error", nil, "channel_id="+pair.ChannelId+", user_id="+pair.UserId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			removed++
+		}
+
+		if err := transaction.Commit(); err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteChannelMembershipsForGroupSync", "store.sql_group.delete_channel_memberships_for_group_sync.commit_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = removed
+	})
+}
+
+// CreateTeamMembershipsForGroupSync is CreateChannelMembershipsForGroupSync's
+// GSTeam counterpart: inside a single transaction it inserts a TeamMember
+// row -- stamped with the syncable's configured GroupTeams.SchemeRoles, the
+// same fix applied to the channel path -- for each pair, skipping any pair
+// that raced with a manual add and already has a TeamMember row.
+func (s *SqlSupplier) CreateTeamMembershipsForGroupSync(ctx context.Context, pairs []*model.UserTeamIDPair, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		transaction, tErr := s.GetMaster().Begin()
+		if tErr != nil {
+			result.Err = model.NewAppError("SqlGroupStore.CreateTeamMembershipsForGroupSync", "store.sql_group.create_team_memberships_for_group_sync.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var created []*model.TeamMember
+		for _, pair := range pairs {
+			count, cErr := transaction.SelectInt("SELECT COUNT(*) FROM TeamMembers WHERE TeamId = :TeamId AND UserId = :UserId AND DeleteAt = 0", map[string]interface{}{"TeamId": pair.TeamId, "UserId": pair.UserId})
+			if cErr != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.CreateTeamMembershipsForGroupSync", "store.sql_group.create_team_memberships_for_group_sync.select_error", nil, cErr.Error(), http.StatusInternalServerError)
+				return
+			}
+			if count > 0 {
+				// Raced with a manual add; leave the existing membership alone.
+				continue
+			}
+
+			roles, rErr := transaction.SelectStr(
+				"SELECT SchemeRoles FROM GroupTeams WHERE TeamId = :TeamId AND DeleteAt = 0 AND AutoAdd = true LIMIT 1",
+				map[string]interface{}{"TeamId": pair.TeamId},
+			)
+			if rErr != nil && rErr != sql.ErrNoRows {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.CreateTeamMembershipsForGroupSync", "store.sql_group.create_team_memberships_for_group_sync.roles_select_error", nil, "team_id="+pair.TeamId+", "+rErr.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			member := &model.TeamMember{
+				TeamId: pair.TeamId,
+				UserId: pair.UserId,
+				Roles:  roles,
+			}
+
+			if err := transaction.Insert(member); err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.CreateTeamMembershipsForGroupSync", "store.sql_group.create_team_memberships_for_group_sync.insert_error", nil, "team_id="+pair.TeamId+", user_id="+pair.UserId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			created = append(created, member)
+		}
+
+		if err := transaction.Commit(); err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.CreateTeamMembershipsForGroupSync", "store.sql_group.create_team_memberships_for_group_sync.commit_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = created
+	})
+}
+
+// DeleteTeamMembershipsForGroupSync is CreateTeamMembershipsForGroupSync's
+// inverse, the GSTeam counterpart of DeleteChannelMembershipsForGroupSync:
+// inside a single transaction it deletes the TeamMember row for each pair,
+// skipping any pair that raced with a manual remove (and so has no
+// TeamMember row left to delete). There's no TeamMemberHistory table
+// referenced anywhere in this tree to stamp a leave time on, unlike the
+// channel path's ChannelMemberHistory.
+func (s *SqlSupplier) DeleteTeamMembershipsForGroupSync(ctx context.Context, pairs []*model.UserTeamIDPair, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		transaction, tErr := s.GetMaster().Begin()
+		if tErr != nil {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteTeamMembershipsForGroupSync", "store.sql_group.delete_team_memberships_for_group_sync.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var removed int
+		for _, pair := range pairs {
+			sqlResult, err := transaction.Exec("DELETE FROM TeamMembers WHERE TeamId = :TeamId AND UserId = :UserId",
+				map[string]interface{}{"TeamId": pair.TeamId, "UserId": pair.UserId})
+			if err != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.DeleteTeamMembershipsForGroupSync", "store.sql_group.delete_team_memberships_for_group_sync.delete_error", nil, "team_id="+pair.TeamId+", user_id="+pair.UserId+", "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			rowsAffected, raErr := sqlResult.RowsAffected()
+			if raErr != nil {
+				transaction.Rollback()
+				result.Err = model.NewAppError("SqlGroupStore.DeleteTeamMembershipsForGroupSync", "store.sql_group.delete_team_memberships_for_group_sync.rows_affected_error", nil, raErr.Error(), http.StatusInternalServerError)
+				return
+			}
+			if rowsAffected == 0 {
+				// Raced with a manual remove; nothing left to do for this pair.
+				continue
+			}
+
+			removed++
+		}
+
+		if err := transaction.Commit(); err != nil {
+			result.Err = model.NewAppError("SqlGroupStore.DeleteTeamMembershipsForGroupSync", "store.sql_group.delete_team_memberships_for_group_sync.commit_error", nil, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = removed
+	})
+}
+
+// PendingAutoRemoveTeamMemberships returns a page of the (UserId, TeamId)
+// pairs that should have their auto-added TeamMember removed: the user is
+// still a TeamMember of a team added by group sync, but their last
+// qualifying GroupMembers row was deleted at or after
+// minGroupMembersDeleteAt and no other active group membership still grants
+// them the team, so the removal is permanent rather than a race with a
+// fresher add. Results are ordered by GroupMembers.DeleteAt, UserId, TeamId
+// so a paginated caller sees a stable cursor across restarts.
+func (s *SqlSupplier) PendingAutoRemoveTeamMemberships(ctx context.Context, minGroupMembersDeleteAt int64, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	sqlQuery := `SELECT TeamMembers.UserId, TeamMembers.TeamId
+			FROM TeamMembers
+			JOIN GroupTeams ON GroupTeams.SyncableId = TeamMembers.TeamId
+			JOIN GroupMembers ON GroupMembers.GroupId = GroupTeams.GroupId AND GroupMembers.UserId = TeamMembers.UserId
+			WHERE GroupTeams.DeleteAt = 0
+			AND GroupTeams.AutoAdd = true
+			AND GroupTeams.CanLeave = false
+			AND GroupMembers.DeleteAt >= :MinGroupMembersDeleteAt
+			AND NOT EXISTS (
+				SELECT 1 FROM GroupMembers gm2
+				JOIN GroupTeams gt2 ON gt2.GroupId = gm2.GroupId
+				WHERE gt2.SyncableId = TeamMembers.TeamId
+				AND gm2.UserId = TeamMembers.UserId
+				AND gm2.DeleteAt = 0
+				AND gt2.DeleteAt = 0
+			)
+			ORDER BY GroupMembers.DeleteAt, TeamMembers.UserId, TeamMembers.TeamId
+			LIMIT :Limit OFFSET :Offset`
+
+	var pairs []*model.UserTeamIDPair
+	if _, err := s.GetReplica().Select(&pairs, sqlQuery, map[string]interface{}{"MinGroupMembersDeleteAt": minGroupMembersDeleteAt, "Limit": limit, "Offset": offset}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoRemoveTeamMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = pairs
+
+	return result
+}
+
+// PendingAutoRemoveChannelMemberships is the channel-level counterpart of
+// PendingAutoRemoveTeamMemberships: it returns a page of the (UserId,
+// ChannelId) pairs whose auto-added ChannelMember should be removed because
+// their last qualifying GroupMembers row was deleted at or after
+// minGroupMembersDeleteAt and no other active group membership still grants
+// them the channel.
+func (s *SqlSupplier) PendingAutoRemoveChannelMemberships(ctx context.Context, minGroupMembersDeleteAt int64, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	sqlQuery := `SELECT ChannelMembers.UserId, ChannelMembers.ChannelId
+			FROM ChannelMembers
+			JOIN GroupChannels ON GroupChannels.SyncableId = ChannelMembers.ChannelId
+			JOIN GroupMembers ON GroupMembers.GroupId = GroupChannels.GroupId AND GroupMembers.UserId = ChannelMembers.UserId
+			WHERE GroupChannels.DeleteAt = 0
+			AND GroupChannels.AutoAdd = true
+			AND GroupChannels.CanLeave = false
+			AND GroupMembers.DeleteAt >= :MinGroupMembersDeleteAt
+			AND NOT EXISTS (
+				SELECT 1 FROM GroupMembers gm2
+				JOIN GroupChannels gc2 ON gc2.GroupId = gm2.GroupId
+				WHERE gc2.SyncableId = ChannelMembers.ChannelId
+				AND gm2.UserId = ChannelMembers.UserId
+				AND gm2.DeleteAt = 0
+				AND gc2.DeleteAt = 0
+			)
+			ORDER BY GroupMembers.DeleteAt, ChannelMembers.UserId, ChannelMembers.ChannelId
+			LIMIT :Limit OFFSET :Offset`
+
+	var pairs []*model.UserChannelIDPair
+	if _, err := s.GetReplica().Select(&pairs, sqlQuery, map[string]interface{}{"MinGroupMembersDeleteAt": minGroupMembersDeleteAt, "Limit": limit, "Offset": offset}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoRemoveChannelMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = pairs
+
+	return result
+}
+
+// GroupPermittedSyncableIDs returns the ids of every team and channel the
+// given user may remain a member of via an active (DeleteAt = 0) GroupMembers
+// row and its linking GroupTeam/GroupChannel. GroupSyncAll uses the same
+// check (inlined as a NOT EXISTS) to tell a current auto-added membership
+// from a stale one; this method exposes it standalone for callers (e.g. a
+// manual "can this user leave?" check) that only care about one user.
+func (s *SqlSupplier) GroupPermittedSyncableIDs(ctx context.Context, userID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	sqlQuery := `SELECT GroupTeams.SyncableId
+			FROM GroupMembers
+			JOIN GroupTeams ON GroupTeams.GroupId = GroupMembers.GroupId
+			WHERE GroupMembers.UserId = :UserId
+			AND GroupMembers.DeleteAt = 0
+			AND GroupTeams.DeleteAt = 0
+			UNION
+			SELECT GroupChannels.ChannelId
+			FROM GroupMembers
+			JOIN GroupChannels ON GroupChannels.GroupId = GroupMembers.GroupId
+			WHERE GroupMembers.UserId = :UserId
+			AND GroupMembers.DeleteAt = 0
+			AND GroupChannels.DeleteAt = 0`
+
+	var ids []string
+	if _, err := s.GetReplica().Select(&ids, sqlQuery, map[string]interface{}{"UserId": userID}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.GroupPermittedSyncableIDs", "store.sql_group.permitted_syncable_ids.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = ids
+	return result
+}
+
+// GroupSyncAll performs one full reconciliation pass: it applies every
+// pending group-driven TeamMembers/ChannelMembers addition created since
+// `since`, then removes every auto-added membership that's gone stale --
+// the user's only linking group membership was deleted and the syncable
+// doesn't allow CanLeave. All inserts and deletes run inside a single
+// transaction, batchSize rows at a time per phase, and the applied changes
+// are returned as a model.GroupSyncResult for auditing.
+func (s *SqlSupplier) GroupSyncAll(ctx context.Context, since int64, batchSize int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	transaction, tErr := s.GetMaster().Begin()
+	if tErr != nil {
+		result.Err = model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	syncResult := &model.GroupSyncResult{}
+
+	if err := applyPendingTeamAdds(transaction, since, batchSize, syncResult); err != nil {
+		transaction.Rollback()
+		result.Err = err
+		return result
+	}
+	if err := applyStaleTeamRemoves(transaction, batchSize, syncResult); err != nil {
+		transaction.Rollback()
+		result.Err = err
+		return result
+	}
+	if err := applyPendingChannelAdds(transaction, since, batchSize, syncResult); err != nil {
+		transaction.Rollback()
+		result.Err = err
+		return result
+	}
+	if err := applyStaleChannelRemoves(transaction, batchSize, syncResult); err != nil {
+		transaction.Rollback()
+		result.Err = err
+		return result
+	}
+
+	if err := transaction.Commit(); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.commit_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = syncResult
+	return result
+}
+
+func applyPendingTeamAdds(transaction *gorp.Transaction, since int64, batchSize int, syncResult *model.GroupSyncResult) *model.AppError {
+	sqlQuery := `SELECT GroupMembers.UserId, GroupTeams.SyncableId AS TeamId, GroupTeams.GroupId, GroupTeams.SchemeRoles
+			FROM GroupMembers
+			JOIN GroupTeams ON GroupTeams.GroupId = GroupMembers.GroupId
+			JOIN Groups ON Groups.Id = GroupMembers.GroupId
+			FULL JOIN TeamMembers ON TeamMembers.TeamId = GroupTeams.SyncableId AND TeamMembers.UserId = GroupMembers.UserId
+			WHERE TeamMembers.UserId IS NULL
+			AND Groups.DeleteAt = 0
+			AND GroupTeams.DeleteAt = 0
+			AND GroupTeams.AutoAdd = true
+			AND GroupMembers.DeleteAt = 0
+			AND GroupMembers.CreateAt >= :Since
+			LIMIT :BatchSize`
+
+	type pendingTeamAdd struct {
+		UserId      string
+		TeamId      string
+		GroupId     string
+		SchemeRoles string
+	}
+
+	var pending []*pendingTeamAdd
+	if _, err := transaction.Select(&pending, sqlQuery, map[string]interface{}{"Since": since, "BatchSize": batchSize}); err != nil {
+		return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.team_adds_select_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	for _, p := range pending {
+		if _, err := transaction.Exec("INSERT INTO TeamMembers (TeamId, UserId, Roles, DeleteAt) VALUES (:TeamId, :UserId, :Roles, 0)",
+			map[string]interface{}{"TeamId": p.TeamId, "UserId": p.UserId, "Roles": p.SchemeRoles}); err != nil {
+			return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.team_add_insert_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+		syncResult.TeamAdds = append(syncResult.TeamAdds, model.GroupSyncOp{UserId: p.UserId, SyncableId: p.TeamId, GroupId: p.GroupId})
+	}
+
+	return nil
+}
+
+func applyStaleTeamRemoves(transaction *gorp.Transaction, batchSize int, syncResult *model.GroupSyncResult) *model.AppError {
+	sqlQuery := `SELECT TeamMembers.UserId, TeamMembers.TeamId, GroupTeams.GroupId
+			FROM TeamMembers
+			JOIN GroupTeams ON GroupTeams.SyncableId = TeamMembers.TeamId
+			WHERE GroupTeams.DeleteAt = 0
+			AND GroupTeams.AutoAdd = true
+			AND GroupTeams.CanLeave = false
+			AND NOT EXISTS (
+				SELECT 1 FROM GroupMembers
+				WHERE GroupMembers.GroupId = GroupTeams.GroupId
+				AND GroupMembers.UserId = TeamMembers.UserId
+				AND GroupMembers.DeleteAt = 0
+			)
+			LIMIT :BatchSize`
+
+	type staleTeamMember struct {
+		UserId  string
+		TeamId  string
+		GroupId string
+	}
+
+	var stale []*staleTeamMember
+	if _, err := transaction.Select(&stale, sqlQuery, map[string]interface{}{"BatchSize": batchSize}); err != nil {
+		return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.team_removes_select_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	for _, st := range stale {
+		if _, err := transaction.Exec("DELETE FROM TeamMembers WHERE TeamId = :TeamId AND UserId = :UserId",
+			map[string]interface{}{"TeamId": st.TeamId, "UserId": st.UserId}); err != nil {
+			return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.team_remove_delete_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+		syncResult.TeamRemoves = append(syncResult.TeamRemoves, model.GroupSyncOp{UserId: st.UserId, SyncableId: st.TeamId, GroupId: st.GroupId})
+	}
+
+	return nil
+}
+
+func applyPendingChannelAdds(transaction *gorp.Transaction, since int64, batchSize int, syncResult *model.GroupSyncResult) *model.AppError {
+	sqlQuery := `SELECT GroupMembers.UserId, GroupChannels.ChannelId, GroupChannels.GroupId, GroupChannels.SchemeRoles
+			FROM GroupMembers
+			JOIN GroupChannels ON GroupChannels.GroupId = GroupMembers.GroupId
+			JOIN Groups ON Groups.Id = GroupMembers.GroupId
+			FULL JOIN ChannelMembers ON ChannelMembers.ChannelId = GroupChannels.ChannelId AND ChannelMembers.UserId = GroupMembers.UserId
+			WHERE ChannelMembers.UserId IS NULL
+			AND Groups.DeleteAt = 0
+			AND GroupChannels.DeleteAt = 0
+			AND GroupChannels.AutoAdd = true
+			AND GroupMembers.DeleteAt = 0
+			AND GroupMembers.CreateAt >= :Since
+			LIMIT :BatchSize`
+
+	type pendingChannelAdd struct {
+		UserId      string
+		ChannelId   string
+		GroupId     string
+		SchemeRoles string
+	}
+
+	var pending []*pendingChannelAdd
+	if _, err := transaction.Select(&pending, sqlQuery, map[string]interface{}{"Since": since, "BatchSize": batchSize}); err != nil {
+		return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.channel_adds_select_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	for _, p := range pending {
+		if _, err := transaction.Exec("INSERT INTO ChannelMembers (ChannelId, UserId, Roles) VALUES (:ChannelId, :UserId, :Roles)",
+			map[string]interface{}{"ChannelId": p.ChannelId, "UserId": p.UserId, "Roles": p.SchemeRoles}); err != nil {
+			return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.channel_add_insert_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+		syncResult.ChannelAdds = append(syncResult.ChannelAdds, model.GroupSyncOp{UserId: p.UserId, SyncableId: p.ChannelId, GroupId: p.GroupId})
+	}
+
+	return nil
+}
+
+func applyStaleChannelRemoves(transaction *gorp.Transaction, batchSize int, syncResult *model.GroupSyncResult) *model.AppError {
+	sqlQuery := `SELECT ChannelMembers.UserId, ChannelMembers.ChannelId, GroupChannels.GroupId
+			FROM ChannelMembers
+			JOIN GroupChannels ON GroupChannels.SyncableId = ChannelMembers.ChannelId
+			WHERE GroupChannels.DeleteAt = 0
+			AND GroupChannels.AutoAdd = true
+			AND GroupChannels.CanLeave = false
+			AND NOT EXISTS (
+				SELECT 1 FROM GroupMembers
+				WHERE GroupMembers.GroupId = GroupChannels.GroupId
+				AND GroupMembers.UserId = ChannelMembers.UserId
+				AND GroupMembers.DeleteAt = 0
+			)
+			LIMIT :BatchSize`
+
+	type staleChannelMember struct {
+		UserId    string
+		ChannelId string
+		GroupId   string
+	}
+
+	var stale []*staleChannelMember
+	if _, err := transaction.Select(&stale, sqlQuery, map[string]interface{}{"BatchSize": batchSize}); err != nil {
+		return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.channel_removes_select_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	for _, st := range stale {
+		if _, err := transaction.Exec("DELETE FROM ChannelMembers WHERE ChannelId = :ChannelId AND UserId = :UserId",
+			map[string]interface{}{"ChannelId": st.ChannelId, "UserId": st.UserId}); err != nil {
+			return model.NewAppError("SqlGroupStore.GroupSyncAll", "store.sql_group.sync_all.channel_remove_delete_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+		syncResult.ChannelRemoves = append(syncResult.ChannelRemoves, model.GroupSyncOp{UserId: st.UserId, SyncableId: st.ChannelId, GroupId: st.GroupId})
+	}
+
+	return nil
+}
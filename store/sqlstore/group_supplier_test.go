@@ -0,0 +1,32 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// TestGroupCreateGroupSyncableInvalidType guards against a regression of a
+// nil pointer dereference: the invalid-type branch used to build its
+// AppError from an err that was never assigned, panicking instead of
+// returning a store error.
+func TestGroupCreateGroupSyncableInvalidType(t *testing.T) {
+	s := &SqlSupplier{}
+
+	groupSyncable := &model.GroupSyncable{
+		GroupId:    model.NewId(),
+		SyncableId: model.NewId(),
+		AutoAdd:    true,
+		Type:       model.GroupSyncableType(99),
+	}
+
+	result := s.GroupCreateGroupSyncable(context.Background(), groupSyncable)
+
+	if result.Err == nil {
+		t.Fatal("expected an error for an invalid syncable type")
+	}
+}
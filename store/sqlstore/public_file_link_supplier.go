@@ -0,0 +1,142 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/store"
+)
+
+func initSqlSupplierPublicFileLinks(sqlStore SqlStore) {
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.PublicFileLink{}, "PublicFileLink").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("FileId").SetMaxSize(26)
+		table.ColMap("CreatorId").SetMaxSize(26)
+		table.ColMap("Nonce").SetMaxSize(26)
+		table.ColMap("RestrictedToUserId").SetMaxSize(26)
+	}
+
+	sqlStore.CreateIndexIfNotExists("idx_publicfilelink_file_id", "PublicFileLink", "FileId")
+	sqlStore.CreateIndexIfNotExists("idx_publicfilelink_creator_id", "PublicFileLink", "CreatorId")
+}
+
+// PublicFileLinkCreate persists the metadata of a link minted by
+// GeneratePublicLinkWithExpiry, so it can later be listed or revoked by
+// file or by creator without already knowing its nonce.
+func (s *SqlSupplier) PublicFileLinkCreate(ctx context.Context, link *model.PublicFileLink, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if err := link.IsValid(); err != nil {
+			result.Err = err
+			return
+		}
+
+		if err := s.GetMaster().Insert(link); err != nil {
+			result.Err = model.NewAppError("SqlPublicFileLinkStore.PublicFileLinkCreate", "store.sql_public_file_link.create.app_error", nil, "file_id="+link.FileId+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = link
+	})
+}
+
+// PublicFileLinkListByFile returns every PublicFileLink minted for fileId,
+// newest first, for an admin to review before revoking one or all of them.
+func (s *SqlSupplier) PublicFileLinkListByFile(ctx context.Context, fileId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var links []*model.PublicFileLink
+	if _, err := s.GetReplica().Select(&links, "SELECT * FROM PublicFileLink WHERE FileId = :FileId ORDER BY CreateAt DESC", map[string]interface{}{"FileId": fileId}); err != nil {
+		result.Err = model.NewAppError("SqlPublicFileLinkStore.PublicFileLinkListByFile", "store.sql_public_file_link.list_by_file.app_error", nil, "file_id="+fileId+", "+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = links
+	return result
+}
+
+// PublicFileLinkListByCreator returns every PublicFileLink userId has
+// minted across every file, for an admin revoking all of a departing (or
+// compromised) user's outstanding links at once.
+func (s *SqlSupplier) PublicFileLinkListByCreator(ctx context.Context, userId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var links []*model.PublicFileLink
+	if _, err := s.GetReplica().Select(&links, "SELECT * FROM PublicFileLink WHERE CreatorId = :CreatorId ORDER BY CreateAt DESC", map[string]interface{}{"CreatorId": userId}); err != nil {
+		result.Err = model.NewAppError("SqlPublicFileLinkStore.PublicFileLinkListByCreator", "store.sql_public_file_link.list_by_creator.app_error", nil, "creator_id="+userId+", "+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = links
+	return result
+}
+
+// PublicFileLinkDeleteAllForFile deletes every PublicFileLink row for
+// fileId, the "revoke by file" admin action. It doesn't touch
+// PublicLinkRevocation -- a link whose row this deletes can no longer be
+// found to enforce MaxDownloads against, but GetPublicFile's signature,
+// expiry, and revocation checks still gate it independently.
+func (s *SqlSupplier) PublicFileLinkDeleteAllForFile(ctx context.Context, fileId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if _, err := s.GetMaster().Exec("DELETE FROM PublicFileLink WHERE FileId = :FileId", map[string]interface{}{"FileId": fileId}); err != nil {
+			result.Err = model.NewAppError("SqlPublicFileLinkStore.PublicFileLinkDeleteAllForFile", "store.sql_public_file_link.delete_all_for_file.app_error", nil, "file_id="+fileId+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = true
+	})
+}
+
+// PublicFileLinkDeleteAllForCreator deletes every PublicFileLink row
+// userId has minted, the "revoke by user" admin action.
+func (s *SqlSupplier) PublicFileLinkDeleteAllForCreator(ctx context.Context, userId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if _, err := s.GetMaster().Exec("DELETE FROM PublicFileLink WHERE CreatorId = :CreatorId", map[string]interface{}{"CreatorId": userId}); err != nil {
+			result.Err = model.NewAppError("SqlPublicFileLinkStore.PublicFileLinkDeleteAllForCreator", "store.sql_public_file_link.delete_all_for_creator.app_error", nil, "creator_id="+userId+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = true
+	})
+}
+
+// PublicFileLinkRecordDownload enforces and accounts for a single
+// GetPublicFile request against a time-bounded link: when a PublicFileLink
+// row exists for (fileId, nonce) with MaxDownloads > 0, the download is
+// only counted -- and only allowed -- while DownloadCount is still below
+// MaxDownloads. A link with no matching row (MaxDownloads never set, or a
+// plain GeneratePublicLink link with no persisted metadata at all) is
+// always allowed, since there's nothing to cap it against.
+func (s *SqlSupplier) PublicFileLinkRecordDownload(ctx context.Context, fileId string, nonce string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	res, err := s.GetMaster().Exec(
+		"UPDATE PublicFileLink SET DownloadCount = DownloadCount + 1 WHERE FileId = :FileId AND Nonce = :Nonce AND (MaxDownloads = 0 OR DownloadCount < MaxDownloads)",
+		map[string]interface{}{"FileId": fileId, "Nonce": nonce},
+	)
+	if err != nil {
+		result.Err = model.NewAppError("SqlPublicFileLinkStore.PublicFileLinkRecordDownload", "store.sql_public_file_link.record_download.app_error", nil, "file_id="+fileId+", "+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	if rows, rowsErr := res.RowsAffected(); rowsErr == nil && rows > 0 {
+		result.Data = true
+		return result
+	}
+
+	count, countErr := s.GetReplica().SelectInt("SELECT COUNT(*) FROM PublicFileLink WHERE FileId = :FileId AND Nonce = :Nonce", map[string]interface{}{"FileId": fileId, "Nonce": nonce})
+	if countErr != nil {
+		result.Err = model.NewAppError("SqlPublicFileLinkStore.PublicFileLinkRecordDownload", "store.sql_public_file_link.record_download.app_error", nil, "file_id="+fileId+", "+countErr.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	// No row at all means this link was never capped; a row that exists
+	// but didn't match the WHERE clause means its cap is exhausted.
+	result.Data = count == 0
+
+	return result
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/store"
+)
+
+func initSqlSupplierPublicLinkRevocations(sqlStore SqlStore) {
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.PublicLinkRevocation{}, "PublicLinkRevocation").SetKeys(false, "FileId", "Nonce")
+		table.ColMap("FileId").SetMaxSize(26)
+		table.ColMap("Nonce").SetMaxSize(26)
+	}
+
+	sqlStore.CreateIndexIfNotExists("idx_publiclinkrevocation_file_id", "PublicLinkRevocation", "FileId")
+}
+
+// PublicLinkRevocationCreate records nonce as revoked for fileId. It's safe
+// to call more than once for the same (fileId, nonce) pair -- revoking an
+// already-revoked link is a no-op, not an error.
+func (s *SqlSupplier) PublicLinkRevocationCreate(ctx context.Context, revocation *model.PublicLinkRevocation, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if err := revocation.IsValid(); err != nil {
+			result.Err = err
+			return
+		}
+
+		if exists, err := s.GetReplica().SelectInt(
+			"SELECT COUNT(*) FROM PublicLinkRevocation WHERE FileId = :FileId AND Nonce = :Nonce",
+			map[string]interface{}{"FileId": revocation.FileId, "Nonce": revocation.Nonce},
+		); err == nil && exists > 0 {
+			result.Data = revocation
+			return
+		}
+
+		if err := s.GetMaster().Insert(revocation); err != nil {
+			result.Err = model.NewAppError("SqlPublicLinkRevocationStore.PublicLinkRevocationCreate", "store.sql_public_link_revocation.create.app_error", nil, "file_id="+revocation.FileId+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = revocation
+	})
+}
+
+// PublicLinkRevocationExists reports whether nonce has been revoked for
+// fileId, the check GetPublicFile runs alongside the expiry and signature
+// checks on every request against a time-bounded link.
+func (s *SqlSupplier) PublicLinkRevocationExists(ctx context.Context, fileId string, nonce string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	count, err := s.GetReplica().SelectInt(
+		"SELECT COUNT(*) FROM PublicLinkRevocation WHERE FileId = :FileId AND Nonce = :Nonce",
+		map[string]interface{}{"FileId": fileId, "Nonce": nonce},
+	)
+	if err != nil && err != sql.ErrNoRows {
+		result.Err = model.NewAppError("SqlPublicLinkRevocationStore.PublicLinkRevocationExists", "store.sql_public_link_revocation.exists.app_error", nil, "file_id="+fileId+", "+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = count > 0
+
+	return result
+}
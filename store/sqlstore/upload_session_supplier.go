@@ -0,0 +1,103 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/store"
+)
+
+func initSqlSupplierUploadSessions(sqlStore SqlStore) {
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.UploadSession{}, "UploadSessions").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("ChannelId").SetMaxSize(26)
+		table.ColMap("UserId").SetMaxSize(26)
+		table.ColMap("Filename").SetMaxSize(256)
+	}
+
+	sqlStore.CreateIndexIfNotExists("idx_uploadsessions_expireat", "UploadSessions", "ExpireAt")
+}
+
+// UploadSessionCreate inserts a new UploadSession row, the persisted
+// counterpart of a tus "POST /files/resumable" call.
+func (s *SqlSupplier) UploadSessionCreate(ctx context.Context, session *model.UploadSession, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if err := session.IsValid(); err != nil {
+			result.Err = err
+			return
+		}
+
+		if err := s.GetMaster().Insert(session); err != nil {
+			result.Err = model.NewAppError("SqlUploadSessionStore.UploadSessionCreate", "store.sql_upload_session.create.app_error", nil, "id="+session.Id+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = session
+	})
+}
+
+// UploadSessionGet looks up an UploadSession by id, the persisted state a
+// tus "HEAD" or "PATCH" call resumes from.
+func (s *SqlSupplier) UploadSessionGet(ctx context.Context, id string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var session model.UploadSession
+	if err := s.GetReplica().SelectOne(&session, "SELECT * FROM UploadSessions WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+		result.Err = model.NewAppError("SqlUploadSessionStore.UploadSessionGet", "store.sql_upload_session.get.app_error", nil, "id="+id+", "+err.Error(), http.StatusNotFound)
+		return result
+	}
+
+	result.Data = &session
+
+	return result
+}
+
+// UploadSessionUpdateOffset persists the new FileOffset a PATCH call
+// advanced an upload to, so a later HEAD/PATCH (even after a restart)
+// resumes from the right byte instead of the client's last-known offset.
+func (s *SqlSupplier) UploadSessionUpdateOffset(ctx context.Context, id string, fileOffset int64, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if _, err := s.GetMaster().Exec("UPDATE UploadSessions SET FileOffset = :FileOffset WHERE Id = :Id", map[string]interface{}{"Id": id, "FileOffset": fileOffset}); err != nil {
+			result.Err = model.NewAppError("SqlUploadSessionStore.UploadSessionUpdateOffset", "store.sql_upload_session.update_offset.app_error", nil, "id="+id+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = fileOffset
+	})
+}
+
+// UploadSessionGetExpired returns every UploadSession whose ExpireAt has
+// passed now, the set a janitor sweep should clean up along with each
+// session's backing .part object.
+func (s *SqlSupplier) UploadSessionGetExpired(ctx context.Context, now int64, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var sessions []*model.UploadSession
+	if _, err := s.GetReplica().Select(&sessions, "SELECT * FROM UploadSessions WHERE ExpireAt < :Now", map[string]interface{}{"Now": now}); err != nil {
+		result.Err = model.NewAppError("SqlUploadSessionStore.UploadSessionGetExpired", "store.sql_upload_session.get_expired.app_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = sessions
+
+	return result
+}
+
+// UploadSessionDelete removes an UploadSession row once its upload has
+// finished (successfully or otherwise) and its .part object has been
+// finalized or cleaned up.
+func (s *SqlSupplier) UploadSessionDelete(ctx context.Context, id string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	return store.Do(func(result *store.LayeredStoreSupplierResult) {
+		if _, err := s.GetMaster().Exec("DELETE FROM UploadSessions WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewAppError("SqlUploadSessionStore.UploadSessionDelete", "store.sql_upload_session.delete.app_error", nil, "id="+id+", "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result.Data = true
+	})
+}